@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers see either the old or the new content, never a
+// partial write. With ENVWARP_FSYNC enabled, the data and the directory entry
+// are flushed to disk as well, making the new content survive a crash.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return copyFileAtomic(path, bytes.NewReader(data), perm)
+}
+
+// copyFileAtomic is writeFileAtomic with the content read from r.
+func copyFileAtomic(path string, r io.Reader, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	// Removing is a no-op once the rename has succeeded.
+	defer os.Remove(tmp.Name())
+
+	fsync := envEnabled("ENVWARP_FSYNC")
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write to %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+	}
+	if fsync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+
+	if fsync {
+		// Not all platforms can sync a directory, so this is best effort.
+		if d, err := os.Open(dir); err == nil {
+			_ = d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
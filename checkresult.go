@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	checkActionTimeout = 5 * time.Second
+	defaultCheckJob    = "envwarp_check"
+)
+
+// checkResult is the outcome of one run of the check subcommand.
+type checkResult struct {
+	Address  string    `json:"address"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous,omitempty"`
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host,omitempty"`
+	Duration float64   `json:"duration_seconds"`
+}
+
+// checkStatus names the state of a check.
+func checkStatus(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+// reportCheckResult feeds the result of a check to external monitoring: it
+// writes the state to ENVWARP_CHECK_RESULTS_FILE, pushes it to the
+// pushgateway at ENVWARP_CHECK_PUSHGATEWAY and posts it to
+// ENVWARP_CHECK_WEBHOOK when it differs from the previous check. Failures
+// are only logged and never change the check's exit code.
+func reportCheckResult(address string, healthy bool, duration time.Duration) {
+	result := checkResult{
+		Address:  address,
+		Status:   checkStatus(healthy),
+		Time:     time.Now().UTC(),
+		Duration: duration.Seconds(),
+	}
+	result.Host, _ = os.Hostname()
+
+	if path := os.Getenv("ENVWARP_CHECK_RESULTS_FILE"); path != "" {
+		line := fmt.Sprintf("%s %s\n", result.Status, result.Time.Format(time.RFC3339))
+		if err := writeFileAtomic(path, []byte(line), 0644); err != nil {
+			log.Printf("Warning: Failed to write check results file %s: %v", path, err)
+		}
+	}
+	if gateway := os.Getenv("ENVWARP_CHECK_PUSHGATEWAY"); gateway != "" {
+		if err := pushCheckResult(gateway, result, healthy); err != nil {
+			log.Printf("Warning: Failed to push check result to %s: %v", gateway, err)
+		}
+	}
+	if webhook := os.Getenv("ENVWARP_CHECK_WEBHOOK"); webhook != "" {
+		if err := notifyCheckChange(webhook, result); err != nil {
+			log.Printf("Warning: Failed to post check result to %s: %v", webhook, err)
+		}
+	}
+}
+
+// pushCheckResult replaces the check metrics on a Prometheus pushgateway.
+// They are grouped by the checked address, so several checks and the render
+// metrics of the same job do not overwrite each other.
+func pushCheckResult(gateway string, result checkResult, healthy bool) error {
+	var b strings.Builder
+	for _, metric := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"envwarp_check_success", "Whether the last check passed (1) or failed (0).", boolValue(healthy)},
+		{"envwarp_check_duration_seconds", "Time taken by the last check.", result.Duration},
+		{"envwarp_check_timestamp_seconds", "Unix time of the last check.", float64(result.Time.Unix())},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", metric.name, metric.help, metric.name, metric.name, metric.value)
+	}
+
+	job := os.Getenv("ENVWARP_CHECK_JOB")
+	if job == "" {
+		job = defaultCheckJob
+	}
+	address := strings.TrimSuffix(gateway, "/") + "/metrics/job@base64/" + base64.RawURLEncoding.EncodeToString([]byte(job)) +
+		"/check@base64/" + base64.RawURLEncoding.EncodeToString([]byte(result.Address))
+	code, err := httpRequest("PUT", address, "text/plain; version=0.0.4", []byte(b.String()), checkActionTimeout)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("unexpected status code %d", code)
+	}
+	return nil
+}
+
+// notifyCheckChange posts result to webhook if its status differs from the
+// previous check of the same address, which is kept in
+// ENVWARP_CHECK_STATE_FILE. The state is only updated once the webhook has
+// accepted the change, so a failed delivery is retried by the next check.
+func notifyCheckChange(webhook string, result checkResult) error {
+	statePath := checkStatePath(result.Address)
+	if data, err := os.ReadFile(statePath); err == nil {
+		result.Previous = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read check state %s: %w", statePath, err)
+	}
+	if result.Previous == result.Status {
+		return nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	code, err := httpRequest("POST", webhook, "application/json", body, checkActionTimeout)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("unexpected status code %d", code)
+	}
+	if err := writeFileAtomic(statePath, []byte(result.Status+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write check state %s: %w", statePath, err)
+	}
+	return nil
+}
+
+// checkStatePath returns ENVWARP_CHECK_STATE_FILE, or a file in the
+// temporary directory named after address, as each check runs in a new
+// process.
+func checkStatePath(address string) string {
+	if path := os.Getenv("ENVWARP_CHECK_STATE_FILE"); path != "" {
+		return path
+	}
+	sum := sha256.Sum256([]byte(address))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("envwarp-check-%x.state", sum[:6]))
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// executionArgs returns the argv of the command to execute. It is taken from
+// ENVWARP_EXECUTION_ARGS (a JSON array), numbered ENVWARP_EXECUTION_ARG_n
+// variables starting at 0, or ENVWARP_EXECUTION, in that order of preference.
+// The first two define argv exactly, without splitting or substitution.
+func executionArgs() ([]string, error) {
+	if value := os.Getenv("ENVWARP_EXECUTION_ARGS"); value != "" {
+		var argv []string
+		if err := json.Unmarshal([]byte(value), &argv); err != nil {
+			return nil, fmt.Errorf("ENVWARP_EXECUTION_ARGS must be a JSON array of strings: %w", err)
+		}
+		if len(argv) == 0 {
+			return nil, errors.New("ENVWARP_EXECUTION_ARGS is empty")
+		}
+		return argv, nil
+	}
+
+	var argv []string
+	for i := 0; ; i++ {
+		value, ok := os.LookupEnv("ENVWARP_EXECUTION_ARG_" + strconv.Itoa(i))
+		if !ok {
+			break
+		}
+		argv = append(argv, value)
+	}
+	if len(argv) > 0 {
+		return argv, nil
+	}
+
+	argv, err := splitCommand(os.Getenv("ENVWARP_EXECUTION"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENVWARP_EXECUTION: %w", err)
+	}
+	return argv, nil
+}
+
+// augmentPath applies ENVWARP_PATH_PREPEND and ENVWARP_PATH_APPEND to PATH,
+// for envwarp's own command lookups and for the executed command.
+func augmentPath(childEnv []string) []string {
+	prepend := os.Getenv("ENVWARP_PATH_PREPEND")
+	appendPath := os.Getenv("ENVWARP_PATH_APPEND")
+	if prepend == "" && appendPath == "" {
+		return childEnv
+	}
+
+	var dirs []string
+	if prepend != "" {
+		dirs = append(dirs, prepend)
+	}
+	if current := os.Getenv("PATH"); current != "" {
+		dirs = append(dirs, current)
+	}
+	if appendPath != "" {
+		dirs = append(dirs, appendPath)
+	}
+	path := strings.Join(dirs, string(os.PathListSeparator))
+	log.Printf("Using PATH: %s", path)
+	return exportEnv(childEnv, "PATH", path)
+}
+
+// passOnlyEnv restricts the child environment to the variables allowed by
+// ENVWARP_PASS_ONLY, a comma-separated list of names with optional * wildcards
+// such as APP_*. envwarp itself keeps seeing the full environment.
+func passOnlyEnv(childEnv []string) ([]string, error) {
+	patterns := splitList(os.Getenv("ENVWARP_PASS_ONLY"))
+	if len(patterns) == 0 {
+		return childEnv, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ENVWARP_PASS_ONLY pattern %q: %w", pattern, err)
+		}
+	}
+
+	passed := []string{}
+	for _, entry := range childEnvironment(childEnv) {
+		name, _, _ := strings.Cut(entry, "=")
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				passed = append(passed, entry)
+				break
+			}
+		}
+	}
+	return passed, nil
+}
+
+// lookupCommand resolves argv[0] in PATH. If it cannot be found and
+// ENVWARP_EXECUTION_FALLBACK is set, the fallback command is used instead.
+// It returns the resolved path together with the argv to run.
+func lookupCommand(argv []string) (string, []string, error) {
+	cmdPath, err := exec.LookPath(argv[0])
+	if err == nil {
+		return cmdPath, argv, nil
+	}
+
+	fallback := os.Getenv("ENVWARP_EXECUTION_FALLBACK")
+	if fallback == "" {
+		return "", nil, fmt.Errorf("command not found in PATH: %s", argv[0])
+	}
+	fallbackArgv, err := splitCommand(fallback)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid ENVWARP_EXECUTION_FALLBACK: %w", err)
+	}
+	if len(fallbackArgv) == 0 {
+		return "", nil, errors.New("ENVWARP_EXECUTION_FALLBACK is empty")
+	}
+	log.Printf("Warning: Command not found in PATH: %s, running fallback: %s", argv[0], fallback)
+	cmdPath, err = exec.LookPath(fallbackArgv[0])
+	if err != nil {
+		return "", nil, fmt.Errorf("neither command nor fallback found in PATH: %s, %s", argv[0], fallbackArgv[0])
+	}
+	return cmdPath, fallbackArgv, nil
+}
+
+// splitCommand splits a command line into its arguments using shell-like
+// quoting rules and substitutes ${VAR} references in each argument.
+// Substitution happens after splitting, so values containing spaces stay a
+// single argument. Single-quoted text is taken literally, and `\$` or `$$`
+// produce a literal dollar sign.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg, segment strings.Builder
+	inArg := false
+	var quote rune
+
+	// flush expands the pending segment and appends it to the current argument.
+	flush := func() error {
+		if segment.Len() == 0 {
+			return nil
+		}
+		expanded, err := expandEnv(segment.String())
+		if err != nil {
+			return err
+		}
+		arg.WriteString(expanded)
+		segment.Reset()
+		return nil
+	}
+	// literal adds a character that must not be expanded.
+	literal := func(r rune) {
+		if r == '$' {
+			segment.WriteString("$$")
+			return
+		}
+		segment.WriteRune(r)
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+				continue
+			}
+			arg.WriteRune(r)
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]):
+				i++
+				literal(runes[i])
+			default:
+				segment.WriteRune(r)
+			}
+		case r == '\'':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			quote = r
+			inArg = true
+		case r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				literal(runes[i])
+			}
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if !inArg {
+				continue
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			args = append(args, arg.String())
+			arg.Reset()
+			inArg = false
+		default:
+			segment.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	t.Setenv("SPLIT_NAME", "two words")
+	t.Setenv("SPLIT_EMPTY", "")
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{command: "app serve --port 80", want: []string{"app", "serve", "--port", "80"}},
+		{command: "  app \t serve\n", want: []string{"app", "serve"}},
+		{command: `app "a b" 'c d'`, want: []string{"app", "a b", "c d"}},
+		{command: `app ${SPLIT_NAME}`, want: []string{"app", "two words"}},
+		{command: `app --name=${SPLIT_NAME}x`, want: []string{"app", "--name=two wordsx"}},
+		{command: `app "${SPLIT_NAME}"`, want: []string{"app", "two words"}},
+		{command: `app '${SPLIT_NAME}'`, want: []string{"app", "${SPLIT_NAME}"}},
+		{command: `app \${SPLIT_NAME} $${SPLIT_NAME}`, want: []string{"app", "${SPLIT_NAME}", "${SPLIT_NAME}"}},
+		{command: `app "\"quoted\" \$x"`, want: []string{"app", `"quoted" $x`}},
+		{command: `app a\ b`, want: []string{"app", "a b"}},
+		{command: `app "" ''`, want: []string{"app", "", ""}},
+		{command: `app ${SPLIT_EMPTY}`, want: []string{"app", ""}},
+		{command: "", want: nil},
+		{command: `app "open`, wantErr: true},
+		{command: `app 'open`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.command)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitCommand(%q) = %q, want error", tt.command, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitCommand(%q) failed: %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
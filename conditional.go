@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// conditionalDirective matches an envsubst-mode conditional line: #if EXPR,
+// #elif EXPR, #else or #endif.
+var conditionalDirective = regexp.MustCompile(`^[ \t]*#(if|elif|else|endif)(?:[ \t]+(.*?))?[ \t]*\r?\n?$`)
+
+// conditionalBlock is an open #if block while conditionals are processed.
+type conditionalBlock struct {
+	line int
+	// outer reports whether the enclosing blocks are active.
+	outer bool
+	// active reports whether the current branch is rendered, taken whether
+	// any branch so far has been.
+	active, taken bool
+	inElse        bool
+}
+
+// conditionals processes the directives of one file line by line, so large
+// templates can be streamed through it.
+type conditionals struct {
+	file  string
+	stack []*conditionalBlock
+}
+
+// expandConditionals keeps or drops the lines between #if, #elif, #else and
+// #endif directives in body before variables are substituted. Conditions of
+// blocks that are not rendered are not evaluated. Errors are reported as a
+// *templateError positioned in file.
+func expandConditionals(file string, body []byte) ([]byte, error) {
+	// Directives are rare, so most templates skip the line scan
+	if !bytes.Contains(body, []byte("#if")) && !bytes.Contains(body, []byte("#e")) {
+		return body, nil
+	}
+
+	var out bytes.Buffer
+	c := &conditionals{file: file}
+	for i, line := range bytes.SplitAfter(body, []byte("\n")) {
+		keep, err := c.line(i+1, line)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			out.Write(line)
+		}
+	}
+	if err := c.end(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// active reports whether lines are currently rendered.
+func (c *conditionals) active() bool {
+	return len(c.stack) == 0 || c.stack[len(c.stack)-1].active
+}
+
+// line processes the lineNo-th line of the file and reports whether it is
+// kept in the output. Directive lines themselves are never kept.
+func (c *conditionals) line(lineNo int, line []byte) (bool, error) {
+	if bytes.IndexByte(line, '#') == -1 {
+		return c.active(), nil
+	}
+	m := conditionalDirective.FindSubmatch(line)
+	if m == nil {
+		return c.active(), nil
+	}
+
+	directive, expr := string(m[1]), string(m[2])
+	fail := func(msg string) error {
+		return &templateError{file: c.file, line: lineNo, expr: strings.TrimSpace(string(line)), err: errors.New(msg)}
+	}
+	var top *conditionalBlock
+	if len(c.stack) > 0 {
+		top = c.stack[len(c.stack)-1]
+	}
+	switch directive {
+	case "if":
+		if expr == "" {
+			return false, fail("#if without a condition")
+		}
+		block := &conditionalBlock{line: lineNo, outer: c.active()}
+		if block.outer {
+			ok, err := evalCondition(expr)
+			if err != nil {
+				return false, fail(err.Error())
+			}
+			block.active, block.taken = ok, ok
+		}
+		c.stack = append(c.stack, block)
+	case "elif":
+		if top == nil || top.inElse {
+			return false, fail("#elif without #if")
+		}
+		if expr == "" {
+			return false, fail("#elif without a condition")
+		}
+		top.active = false
+		if top.outer && !top.taken {
+			ok, err := evalCondition(expr)
+			if err != nil {
+				return false, fail(err.Error())
+			}
+			top.active, top.taken = ok, ok
+		}
+	case "else":
+		if top == nil || top.inElse {
+			return false, fail("#else without #if")
+		}
+		top.inElse = true
+		top.active = top.outer && !top.taken
+		top.taken = true
+	case "endif":
+		if top == nil {
+			return false, fail("#endif without #if")
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return false, nil
+}
+
+// end reports an error if a block is still open at the end of the file.
+func (c *conditionals) end() error {
+	if len(c.stack) > 0 {
+		block := c.stack[len(c.stack)-1]
+		return &templateError{file: c.file, line: block.line, err: errors.New("#if without #endif")}
+	}
+	return nil
+}
+
+// evalCondition evaluates the condition of an #if or #elif directive: a
+// value that is true unless it expands to an empty string, 0, false, no or
+// off, optionally negated with !, or a comparison of two values with == or
+// !=. Values may be quoted.
+func evalCondition(expr string) (bool, error) {
+	for _, op := range []string{"==", "!="} {
+		if left, right, ok := strings.Cut(expr, op); ok {
+			l, err := conditionValue(left)
+			if err != nil {
+				return false, err
+			}
+			r, err := conditionValue(right)
+			if err != nil {
+				return false, err
+			}
+			return (l == r) == (op == "=="), nil
+		}
+	}
+
+	expr = strings.TrimSpace(expr)
+	negate := strings.HasPrefix(expr, "!")
+	value, err := conditionValue(strings.TrimPrefix(expr, "!"))
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no", "off":
+		return negate, nil
+	}
+	return !negate, nil
+}
+
+// conditionValue strips the quotes of one operand of a condition and
+// expands it.
+func conditionValue(operand string) (string, error) {
+	operand = strings.TrimSpace(operand)
+	if n := len(operand); n >= 2 && (operand[0] == '"' || operand[0] == '\'') && operand[n-1] == operand[0] {
+		operand = operand[1 : n-1]
+	}
+	return expandEnv(operand)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvalCondition(t *testing.T) {
+	t.Setenv("COND_ENV", "prod")
+	t.Setenv("COND_ON", "yes")
+	t.Setenv("COND_OFF", "Off")
+	t.Setenv("COND_ZERO", "0")
+	t.Setenv("COND_EMPTY", "")
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"${COND_ON}", true},
+		{"${COND_ENV}", true},
+		{"${COND_OFF}", false},
+		{"${COND_ZERO}", false},
+		{"${COND_EMPTY}", false},
+		{"${COND_UNSET}", false},
+		{"!${COND_UNSET}", true},
+		{"! ${COND_ON}", false},
+		{"${COND_ENV} == prod", true},
+		{`${COND_ENV} == "prod"`, true},
+		{"'${COND_ENV}' != 'prod'", false},
+		{"${COND_ENV} != staging", true},
+		{"${COND_UNSET} == ''", true},
+		{"${COND_UNSET:-dev} == dev", true},
+	}
+	for _, tt := range tests {
+		got, err := evalCondition(tt.expr)
+		if err != nil {
+			t.Errorf("evalCondition(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evalCondition(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestExpandConditionals(t *testing.T) {
+	t.Setenv("COND_ENV", "prod")
+	t.Setenv("COND_TLS", "1")
+	tests := []struct {
+		name, body, want string
+	}{
+		{
+			name: "no directives",
+			body: "a=1\n# comment\n",
+			want: "a=1\n# comment\n",
+		},
+		{
+			name: "if",
+			body: "a\n#if ${COND_TLS}\ntls\n#endif\nb\n",
+			want: "a\ntls\nb\n",
+		},
+		{
+			name: "elif chain",
+			body: "#if ${COND_ENV} == dev\ndev\n#elif ${COND_ENV} == prod\nprod\n#elif ${COND_TLS}\ntls\n#else\nother\n#endif\n",
+			want: "prod\n",
+		},
+		{
+			name: "else",
+			body: "#if ${COND_UNSET}\nyes\n#else\nno\n#endif\n",
+			want: "no\n",
+		},
+		{
+			name: "nested in inactive block",
+			body: "#if ${COND_UNSET}\n#if ${COND_TLS}\ninner\n#endif\n#else\nouter\n#endif\n",
+			want: "outer\n",
+		},
+		{
+			name: "indented with CRLF",
+			body: "x\r\n  #if ${COND_TLS}\r\ny\r\n  #endif\r\n",
+			want: "x\r\ny\r\n",
+		},
+		{
+			name: "hash inside a line",
+			body: "color=#ifffff\n",
+			want: "color=#ifffff\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := expandConditionals("t.conf", []byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: expandConditionals failed: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: expandConditionals = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpandConditionalsErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		line int
+	}{
+		{"a\n#if\n#endif\n", 2},
+		{"a\n#endif\n", 2},
+		{"#else\n", 1},
+		{"#if 1\n#else\n#elif 1\n#endif\n", 3},
+		{"#if 1\n#else\n#else\n#endif\n", 3},
+		{"a\n#if 1\nb\n", 2},
+	}
+	for _, tt := range tests {
+		_, err := expandConditionals("t.conf", []byte(tt.body))
+		var terr *templateError
+		if !errors.As(err, &terr) {
+			t.Errorf("expandConditionals(%q) error = %v, want a template error", tt.body, err)
+			continue
+		}
+		if terr.file != "t.conf" || terr.line != tt.line {
+			t.Errorf("expandConditionals(%q) error at %s:%d, want t.conf:%d", tt.body, terr.file, terr.line, tt.line)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const defaultDockerRegistry = "https://index.docker.io/v1/"
+
+// setupCredentialFiles generates ~/.netrc and ~/.docker/config.json from
+// credential variables when they are configured.
+func setupCredentialFiles() error {
+	if err := writeNetrc(); err != nil {
+		return err
+	}
+	return writeDockerConfig()
+}
+
+// writeNetrc writes a single netrc entry for ENVWARP_NETRC_MACHINE.
+func writeNetrc() error {
+	machine := os.Getenv("ENVWARP_NETRC_MACHINE")
+	if machine == "" {
+		return nil
+	}
+	login := lookupVar("ENVWARP_NETRC_LOGIN")
+	password := lookupVar("ENVWARP_NETRC_PASSWORD")
+
+	netrcPath := os.Getenv("ENVWARP_NETRC_PATH")
+	if netrcPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot determine home directory for netrc: %w", err)
+		}
+		netrcPath = filepath.Join(home, ".netrc")
+	}
+
+	content := fmt.Sprintf("machine %s\nlogin %s\npassword %s\n", machine, login, password)
+	if err := writeFileAtomic(netrcPath, []byte(content), 0600); err != nil {
+		return err
+	}
+	log.Printf("Generated netrc for %s: %s", machine, netrcPath)
+	return nil
+}
+
+// writeDockerConfig adds registry credentials to a docker config.json,
+// preserving any other settings already present in the file.
+func writeDockerConfig() error {
+	username := lookupVar("ENVWARP_DOCKER_USERNAME")
+	if username == "" {
+		return nil
+	}
+	password := lookupVar("ENVWARP_DOCKER_PASSWORD")
+
+	registry := os.Getenv("ENVWARP_DOCKER_REGISTRY")
+	if registry == "" {
+		registry = defaultDockerRegistry
+	}
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot determine home directory for docker config: %w", err)
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create docker config directory '%s': %w", configDir, err)
+	}
+	configPath := filepath.Join(configDir, "config.json")
+
+	config := map[string]any{}
+	if content, err := os.ReadFile(configPath); err == nil {
+		if err := json.Unmarshal(content, &config); err != nil {
+			return fmt.Errorf("failed to parse existing docker config %s: %w", configPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read docker config %s: %w", configPath, err)
+	}
+
+	auths, _ := config["auths"].(map[string]any)
+	if auths == nil {
+		auths = map[string]any{}
+	}
+	auths[registry] = map[string]string{
+		"auth": base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	config["auths"] = auths
+
+	content, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode docker config: %w", err)
+	}
+	if err := writeFileAtomic(configPath, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	log.Printf("Generated docker config for %s: %s", registry, configPath)
+	return nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCronShell = "/bin/sh"
+
+// cronField is a bitset of the values allowed by one schedule field.
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// cronSchedule is a parsed five-field cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+	// domStar and dowStar record unrestricted day fields, as cron matches
+	// either day field when both are restricted.
+	domStar, dowStar bool
+}
+
+// cronJob is a single crontab entry.
+type cronJob struct {
+	schedule cronSchedule
+	command  string
+	line     int
+
+	mu      sync.Mutex
+	running bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDays = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// matches reports whether t falls on the schedule, at minute resolution.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minute.has(t.Minute()) || !s.hour.has(t.Hour()) || !s.month.has(int(t.Month())) {
+		return false
+	}
+	domMatch := s.dom.has(t.Day())
+	dowMatch := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parseCronSchedule parses a five-field cron expression or a macro like @daily.
+func parseCronSchedule(fields []string) (cronSchedule, error) {
+	var s cronSchedule
+	if len(fields) != 5 {
+		return s, fmt.Errorf("expected 5 schedule fields, got %d", len(fields))
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return s, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return s, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return s, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return s, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return s, fmt.Errorf("day of week: %w", err)
+	}
+	// Both 0 and 7 mean Sunday.
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps.
+func parseCronField(field string, min, max int, names map[string]int) (cronField, error) {
+	var bits cronField
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			loStr, hiStr, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseCronValue(loStr, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(hiStr, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+// parseCrontab reads jobs and KEY=VALUE environment lines from a crontab file.
+func parseCrontab(path string) ([]*cronJob, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open crontab %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var jobs []*cronJob
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if macro, ok := cronMacros[fields[0]]; ok {
+			fields = append(strings.Fields(macro), fields[1:]...)
+		} else if name, value, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(name, " \t*") {
+			env = append(env, strings.TrimSpace(name)+"="+strings.Trim(strings.TrimSpace(value), `"'`))
+			continue
+		}
+		if len(fields) < 6 {
+			return nil, nil, fmt.Errorf("%s:%d: expected schedule and command", path, lineNo)
+		}
+
+		schedule, err := parseCronSchedule(fields[:5])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		jobs = append(jobs, &cronJob{
+			schedule: schedule,
+			command:  strings.Join(fields[5:], " "),
+			line:     lineNo,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read crontab %s: %w", path, err)
+	}
+	return jobs, env, nil
+}
+
+// runScheduler runs the jobs from crontabPath on schedule while supervising
+// the command given by argv. It exits with the command's exit code, or runs until it
+// receives a termination signal if no command is given. On shutdown, no new
+// jobs are started and running ones get the stop grace period to finish
+// before ENVWARP_POST_EXIT is run.
+func runScheduler(crontabPath string, argv []string, customEnv []string) {
+	jobs, cronEnv, err := parseCrontab(crontabPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	grace, err := stopGracePeriod()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	shell := os.Getenv("ENVWARP_CRON_SHELL")
+	if shell == "" {
+		shell = defaultCronShell
+	}
+	jobEnv := append(childEnvironment(customEnv), cronEnv...)
+	log.Printf("Loaded %d cron jobs from %s", len(jobs), crontabPath)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	var running sync.WaitGroup
+	go func() {
+		defer close(stopped)
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-time.After(next.Sub(now)):
+			case <-stop:
+				return
+			}
+			for _, job := range jobs {
+				if job.schedule.matches(next) {
+					running.Add(1)
+					go func() {
+						defer running.Done()
+						job.run(shell, jobEnv)
+					}()
+				}
+			}
+		}
+	}()
+
+	var code int
+	if len(argv) == 0 {
+		code = waitForSignal()
+	} else {
+		emitEvent(execEvent(argv))
+		child, err := startChild(argv, customEnv)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		code = waitChild(child, grace)
+	}
+
+	close(stop)
+	<-stopped
+	waitJobs(&running, grace)
+	if err := runPostExitHook(customEnv, code); err != nil {
+		log.Printf("Error: %v", err)
+	}
+	os.Exit(code)
+}
+
+// waitJobs waits for running cron jobs to finish, giving up after grace
+// unless it is zero.
+func waitJobs(running *sync.WaitGroup, grace time.Duration) {
+	finished := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(finished)
+	}()
+	var timeout <-chan time.Time
+	if grace > 0 {
+		timeout = time.After(grace)
+	}
+	select {
+	case <-finished:
+	case <-timeout:
+		log.Printf("Warning: Cron jobs still running after %s, exiting anyway", grace)
+	}
+}
+
+// run executes the job unless its previous run is still in progress.
+func (j *cronJob) run(shell string, env []string) {
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		log.Printf("Cron job (line %d) still running, skipping: %s", j.line, j.command)
+		return
+	}
+	j.running = true
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		j.running = false
+		j.mu.Unlock()
+	}()
+
+	log.Printf("Running cron job (line %d): %s", j.line, j.command)
+	start := time.Now()
+	cmd := exec.Command(shell, "-c", j.command)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("Cron job (line %d) failed after %s: %v", j.line, time.Since(start).Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("Cron job (line %d) finished in %s", j.line, time.Since(start).Round(time.Millisecond))
+}
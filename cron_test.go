@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		names    map[string]int
+		want     []int
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 5, want: []int{0, 1, 2, 3, 4, 5}},
+		{field: "*/15", min: 0, max: 59, want: []int{0, 15, 30, 45}},
+		{field: "5/20", min: 0, max: 59, want: []int{5, 25, 45}},
+		{field: "1-3,7", min: 0, max: 10, want: []int{1, 2, 3, 7}},
+		{field: "10-20/5", min: 0, max: 59, want: []int{10, 15, 20}},
+		{field: "mon-fri", min: 0, max: 7, names: cronDays, want: []int{1, 2, 3, 4, 5}},
+		{field: "JAN,dec", min: 1, max: 12, names: cronMonths, want: []int{1, 12}},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-1", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "x", min: 0, max: 59, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCronField(tt.field, tt.min, tt.max, tt.names)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCronField(%q) = %b, want error", tt.field, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q) failed: %v", tt.field, err)
+			continue
+		}
+		var want cronField
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if got != want {
+			t.Errorf("parseCronField(%q) = %b, want %b", tt.field, got, want)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	// 2026-10-12 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"0 9 * * mon-fri", at(12, 9, 0), true},
+		{"0 9 * * mon-fri", at(12, 9, 1), false},
+		{"0 9 * * mon-fri", at(11, 9, 0), false},
+		{"*/15 * * * *", at(13, 4, 45), true},
+		{"*/15 * * * *", at(13, 4, 44), false},
+		{"0 0 * * 7", at(11, 0, 0), true},
+		{"0 0 * * 0", at(11, 0, 0), true},
+		// With both day fields restricted, either one matches.
+		{"0 0 1 * mon", at(12, 0, 0), true},
+		{"0 0 1 * mon", at(1, 0, 0), true},
+		{"0 0 1 * mon", at(13, 0, 0), false},
+		// With one of them unrestricted, only the other one counts.
+		{"0 0 1 * *", at(12, 0, 0), false},
+		{"0 0 * oct *", at(13, 0, 0), true},
+		{"0 0 * nov *", at(13, 0, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := parseCronSchedule(strings.Fields(tt.expr))
+		if err != nil {
+			t.Errorf("parseCronSchedule(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := s.matches(tt.t); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.expr, tt.t.Format(time.RFC1123), got, tt.want)
+		}
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, expr := range []string{"* * * *", "* * * * * *", "61 * * * *", "* 24 * * *", "* * 32 * *", "* * * 13 *", "* * * * 8"} {
+		if _, err := parseCronSchedule(strings.Fields(expr)); err == nil {
+			t.Errorf("parseCronSchedule(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dialTCP connects to a host:port address, which may be a bracketed IPv6
+// literal. By default both address families are tried Happy Eyeballs style;
+// ENVWARP_PREFER_IP=ipv4 or ipv6 instead tries all addresses of the
+// preferred family first, one after the other.
+func dialTCP(address string, timeout time.Duration) (net.Conn, error) {
+	resolver, err := dnsResolver()
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: timeout, Resolver: resolver}
+
+	prefer := os.Getenv("ENVWARP_PREFER_IP")
+	switch prefer {
+	case "":
+		return dialer.Dial("tcp", address)
+	case "ipv4", "ipv6":
+	default:
+		return nil, fmt.Errorf("invalid ENVWARP_PREFER_IP %q, must be ipv4 or ipv6", prefer)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	wantV4 := prefer == "ipv4"
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return (addrs[i].IP.To4() != nil) == wantV4 && (addrs[j].IP.To4() != nil) != wantV4
+	})
+
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// withDefaultPort appends port to a host or bracketed IPv6 literal that has
+// none, so "::1", "[::1]" and "example.com" all become dialable addresses.
+func withDefaultPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), port)
+}
+
+// setPreferIPFlags applies the --prefer-ipv4 and --prefer-ipv6 flags.
+func setPreferIPFlags(ipv4, ipv6 bool) {
+	switch {
+	case ipv4 && ipv6:
+		log.Fatal("Error: --prefer-ipv4 and --prefer-ipv6 are mutually exclusive.")
+	case ipv4:
+		os.Setenv("ENVWARP_PREFER_IP", "ipv4")
+	case ipv6:
+		os.Setenv("ENVWARP_PREFER_IP", "ipv6")
+	}
+}
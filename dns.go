@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const defaultDNSTimeout = 5 * time.Second
+
+// dnsResolver returns the resolver for envwarp's own lookups. If
+// ENVWARP_DNS_SERVERS (comma-separated host[:port]) is set, queries go to
+// those servers in turn instead of the ones in /etc/resolv.conf.
+func dnsResolver() (*net.Resolver, error) {
+	servers := splitList(os.Getenv("ENVWARP_DNS_SERVERS"))
+	if len(servers) == 0 {
+		return net.DefaultResolver, nil
+	}
+	for i, server := range servers {
+		server = withDefaultPort(server, "53")
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, fmt.Errorf("invalid ENVWARP_DNS_SERVERS entry %q: %w", servers[i], err)
+		}
+		servers[i] = server
+	}
+	timeout, err := dnsTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			d := net.Dialer{Timeout: timeout}
+			return d.DialContext(ctx, network, server)
+		},
+	}, nil
+}
+
+// dnsTimeout returns the lookup timeout from ENVWARP_DNS_TIMEOUT (default 5s).
+func dnsTimeout() (time.Duration, error) {
+	value := os.Getenv("ENVWARP_DNS_TIMEOUT")
+	if value == "" {
+		return defaultDNSTimeout, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ENVWARP_DNS_TIMEOUT %q: %w", value, err)
+	}
+	return d, nil
+}
+
+// dnsContext returns a context bounded by the lookup timeout.
+func dnsContext() (context.Context, context.CancelFunc, error) {
+	timeout, err := dnsTimeout()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return ctx, cancel, nil
+}
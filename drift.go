@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// driftReport lists the differences between freshly rendered templates and
+// the live configuration directory. Paths are relative to the conf dir.
+type driftReport struct {
+	Changed []string `json:"changed"`
+	Missing []string `json:"missing"`
+	Extra   []string `json:"extra"`
+}
+
+func (r *driftReport) hasDrift() bool {
+	return len(r.Changed) > 0 || len(r.Missing) > 0 || len(r.Extra) > 0
+}
+
+// runDrift renders templates into a temporary directory, compares the result
+// against ENVWARP_CONFDIR and prints a JSON drift report to stdout.
+// It exits with 1 if drift was detected, 2 on errors and 0 otherwise.
+func runDrift(args []string) {
+	var envFiles, templateFlags stringSlice
+	driftCmd := flag.NewFlagSet("drift", flag.ExitOnError)
+	driftCmd.Var(&envFiles, "e", "path to a custom environment file (can be specified multiple times)")
+	driftCmd.Var(&envFiles, "env", "path to a custom environment file (can be specified multiple times)")
+	driftCmd.Var(&templateFlags, "template", "template file or directory to render (can be specified multiple times, overrides ENVWARP_TEMPLATE)")
+	tagsFlag := driftCmd.String("tags", "", "comma-separated template tags to render (overrides ENVWARP_TAGS)")
+	extFlag := driftCmd.String("template-ext", "", "comma-separated template file extensions (overrides ENVWARP_TEMPLATE_EXT)")
+	binaryFlag := driftCmd.String("binary", "", "how to handle binary templates: fail or copy (overrides ENVWARP_BINARY)")
+	strictFlag := driftCmd.Bool("strict", false, "fail on unset variables referenced by templates (same as ENVWARP_STRICT=1)")
+	passthroughFlag := driftCmd.Bool("passthrough", false, "leave references to unset variables in the output as they are (same as ENVWARP_PASSTHROUGH=1)")
+	keepTempFlag := driftCmd.Bool("keep-temp", false, "keep the temporary directory for debugging (same as ENVWARP_KEEP_TEMP=1)")
+	driftCmd.Parse(args)
+	setTemplateFlag(templateFlags)
+	setEnvFlag("ENVWARP_TAGS", *tagsFlag)
+	setEnvFlag("ENVWARP_TEMPLATE_EXT", *extFlag)
+	setEnvFlag("ENVWARP_BINARY", *binaryFlag)
+	setStrictFlag(*strictFlag)
+	setPassthroughFlag(*passthroughFlag)
+	setKeepTempFlag(*keepTempFlag)
+
+	if len(envFiles) > 0 {
+		if err := loadEnvFiles(envFiles); err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(2)
+		}
+	}
+
+	// Secrets are resolved for rendering only, nothing is written to disk.
+	if err := processSecrets(""); err != nil {
+		log.Printf("Error: Failed to process secrets: %v", err)
+		os.Exit(2)
+	}
+
+	templatePath := os.Getenv("ENVWARP_TEMPLATE")
+	confDir := os.Getenv("ENVWARP_CONFDIR")
+	if templatePath == "" || confDir == "" {
+		log.Print("Error: ENVWARP_TEMPLATE and ENVWARP_CONFDIR environment variables must be set.")
+		os.Exit(2)
+	}
+
+	report, err := detectDrift(templatePath, confDir)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(2)
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Error: Failed to encode drift report: %v", err)
+		os.Exit(2)
+	}
+	fmt.Println(string(out))
+
+	if report.hasDrift() {
+		log.Printf("Drift detected: %d changed, %d missing, %d extra", len(report.Changed), len(report.Missing), len(report.Extra))
+		os.Exit(1)
+	}
+	log.Println("No drift detected.")
+	os.Exit(0)
+}
+
+// detectDrift renders templatePath into a temporary directory and compares it with confDir.
+func detectDrift(templatePath, confDir string) (*driftReport, error) {
+	defer cleanupScratch()
+	tmpDir, err := scratchTemp("drift-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	absDir, err := scratchTemp("drift-abs-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	absoluteOutputBase = absDir
+	_, err = renderAll(templatePath, tmpDir)
+	absoluteOutputBase = ""
+	if err != nil {
+		return nil, fmt.Errorf("failed to process templates: %w", err)
+	}
+
+	liveDir := activeConfDir(confDir)
+	report, err := compareDirs(tmpDir, liveDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare against %s: %w", liveDir, err)
+	}
+	abs, err := compareAbsolute(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare absolute outputs: %w", err)
+	}
+	report.Changed = append(report.Changed, abs.Changed...)
+	report.Missing = append(report.Missing, abs.Missing...)
+	return report, nil
+}
+
+// compareDirs compares the files rendered into wantDir with those in liveDir.
+func compareDirs(wantDir, liveDir string) (*driftReport, error) {
+	want, err := listFiles(wantDir)
+	if err != nil {
+		return nil, err
+	}
+	live, err := listFiles(liveDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	report := &driftReport{Changed: []string{}, Missing: []string{}, Extra: []string{}}
+	for rel := range want {
+		if _, ok := live[rel]; !ok {
+			report.Missing = append(report.Missing, rel)
+			continue
+		}
+		wantContent, err := os.ReadFile(filepath.Join(wantDir, rel))
+		if err != nil {
+			return nil, err
+		}
+		liveContent, err := os.ReadFile(filepath.Join(liveDir, rel))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(wantContent, liveContent) {
+			report.Changed = append(report.Changed, rel)
+		}
+	}
+	for rel := range live {
+		if _, ok := want[rel]; !ok {
+			report.Extra = append(report.Extra, rel)
+		}
+	}
+
+	sort.Strings(report.Changed)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	return report, nil
+}
+
+// listFiles returns the set of regular files below root as slash-separated
+// relative paths, leaving out render manifests.
+func listFiles(root string) (map[string]struct{}, error) {
+	files := map[string]struct{}{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && d.Name() != manifestName {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = struct{}{}
+		}
+		return nil
+	})
+	return files, err
+}
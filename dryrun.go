@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// runDryRun renders the templates into a temporary directory and prints a
+// unified diff against the files currently in confDir. It returns the exit
+// code: 0 if nothing would change, 1 if files would change, 2 on error.
+func runDryRun(templatePath, confDir string) int {
+	if templatePath == "" || confDir == "" {
+		log.Print("Error: ENVWARP_TEMPLATE and ENVWARP_CONFDIR environment variables must be set.")
+		return 2
+	}
+
+	defer cleanupScratch()
+	tmpDir, err := scratchTemp("dryrun-")
+	if err != nil {
+		log.Printf("Error: Failed to create temporary directory: %v", err)
+		return 2
+	}
+	absDir, err := scratchTemp("dryrun-abs-")
+	if err != nil {
+		log.Printf("Error: Failed to create temporary directory: %v", err)
+		return 2
+	}
+
+	absoluteOutputBase = absDir
+	_, err = renderAll(templatePath, tmpDir)
+	absoluteOutputBase = ""
+	if err != nil {
+		log.Printf("Error: Failed to process templates: %v", err)
+		return 2
+	}
+
+	liveDir := activeConfDir(confDir)
+	report, err := compareDirs(tmpDir, liveDir)
+	if err != nil {
+		log.Printf("Error: Failed to compare against %s: %v", liveDir, err)
+		return 2
+	}
+	abs, err := compareAbsolute(absDir)
+	if err != nil {
+		log.Printf("Error: Failed to compare absolute outputs: %v", err)
+		return 2
+	}
+
+	// Extra files are left alone by a render, so only changed and new files
+	// matter. Map each one to its rendered copy and its live path.
+	rendered := map[string]string{}
+	for _, rel := range append(report.Changed, report.Missing...) {
+		rendered[filepath.Join(liveDir, rel)] = filepath.Join(tmpDir, rel)
+	}
+	for _, path := range append(abs.Changed, abs.Missing...) {
+		rendered[filepath.FromSlash(path)] = filepath.Join(absDir, path)
+	}
+	files := make([]string, 0, len(rendered))
+	for path := range rendered {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		content, err := os.ReadFile(rendered[path])
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return 2
+		}
+		oldName := filepath.ToSlash(path)
+		current, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			oldName = "/dev/null"
+		} else if err != nil {
+			log.Printf("Error: %v", err)
+			return 2
+		}
+		fmt.Print(unifiedDiff(oldName, filepath.ToSlash(path), current, content))
+	}
+
+	if len(files) > 0 {
+		log.Printf("Dry run: %d changed, %d new file(s) would be written", len(report.Changed)+len(abs.Changed), len(report.Missing)+len(abs.Missing))
+		return 1
+	}
+	log.Println("Dry run: no changes.")
+	return 0
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// templateEngine returns the rendering engine for a template: its
+// envwarp-engine header if present, otherwise ENVWARP_ENGINE.
+func templateEngine(fm frontMatter) string {
+	if engine := fm["engine"]; engine != "" {
+		return engine
+	}
+	return os.Getenv("ENVWARP_ENGINE")
+}
+
+// checkEngine reports an error for an unknown engine name or an escape mode
+// the engine does not support.
+func checkEngine(engine, escape string) error {
+	switch engine {
+	case "", "envsubst":
+		return checkEscape(escape)
+	case "gotemplate":
+		if escape != "" {
+			return errors.New("envwarp-escape applies to envsubst templates only, use the escape helpers in Go templates")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown template engine %q", engine)
+}
+
+// renderBody renders the body of a job with its engine, charging its output
+// to budget, and normalizes its whitespace.
+func renderBody(job renderJob, budget *outputBudget) ([]byte, error) {
+	var content []byte
+	var err error
+	switch job.engine {
+	case "", "envsubst":
+		content, err = renderEnvsubst(job, budget)
+	case "gotemplate":
+		content, err = renderGoTemplate(job.source, job.body, budget)
+	default:
+		err = checkEngine(job.engine, job.escape)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeWhitespace(content), nil
+}
+
+// renderEnvsubst renders the body of a job with envsubst, after resolving its
+// conditional blocks and includes if directives are enabled.
+func renderEnvsubst(job renderJob, budget *outputBudget) ([]byte, error) {
+	name, body := job.source, job.body
+	var err error
+	if job.directives {
+		if body, err = expandConditionals(name, body); err != nil {
+			return nil, err
+		}
+		if body, err = expandIncludes(body, 0); err != nil {
+			return nil, err
+		}
+	}
+	// The expanded body is held until substitution is done, so it counts
+	// against the budget too; this bounds runaway includes.
+	if err := budget.take(len(body)); err != nil {
+		return nil, err
+	}
+	defer budget.release(len(body))
+
+	text := string(body)
+	if passthroughMode() {
+		text = keepUnsetReferences(text)
+	}
+	var content string
+	escape := valueEscapers[job.escape]
+	if strictMode() {
+		content, err = expandEnvStrict(name, text, escape)
+	} else {
+		content, err = expandEscaped(text, escape)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := budget.take(len(content)); err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// renderGoTemplate renders body as a Go text/template with the environment
+// as its data, so {{ .DB_HOST }} expands to $DB_HOST. Unset variables
+// render as empty strings, or fail with an *unsetVarsError in strict mode.
+func renderGoTemplate(name string, body []byte, budget *outputBudget) ([]byte, error) {
+	strict := strictMode()
+	option := "missingkey=zero"
+	if strict {
+		option = "missingkey=error"
+	}
+	data := environMap()
+	funcs := templateFuncs()
+	depth := 0
+	// include renders a partial with the same data and helpers, so missing
+	// keys inside it are found by the strict mode retries below as well.
+	funcs["include"] = func(path string) (string, error) {
+		content, err := readInclude(path, depth)
+		if err != nil {
+			return "", err
+		}
+		partial, err := template.New(path).Option(option).Funcs(funcs).Parse(string(content))
+		if err != nil {
+			return "", err
+		}
+		depth++
+		defer func() { depth-- }()
+		// The partial's output is charged while it renders and refunded on
+		// return, when the including template's own output is charged.
+		buf := &budgetBuffer{budget: budget}
+		defer buf.Reset()
+		if err := partial.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	tmpl, err := template.New(name).Option(option).Funcs(funcs).Parse(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// In strict mode execution stops at the first missing key, so record it,
+	// fill it in and retry until every missing variable is known.
+	var missing []string
+	buf := &budgetBuffer{budget: budget}
+	for {
+		buf.Reset()
+		err := tmpl.Execute(buf, data)
+		if err == nil {
+			break
+		}
+		key, ok := missingKey(err)
+		if _, exists := data[key]; !strict || !ok || exists {
+			buf.Reset()
+			return nil, err
+		}
+		missing = append(missing, key)
+		data[key] = ""
+	}
+	if len(missing) > 0 {
+		buf.Reset()
+		return nil, &unsetVarsError{names: missing}
+	}
+	return buf.Bytes(), nil
+}
+
+// templateFuncs returns the helper functions available to Go templates: the
+// Sprig library plus envwarp's own helpers, which use names Sprig does not
+// define so Sprig functions keep their documented behavior.
+func templateFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	for name, fn := range envwarpFuncs() {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// envwarpFuncs returns envwarp's own template helpers.
+func envwarpFuncs() template.FuncMap {
+	return template.FuncMap{
+		"var":             lookupVar,
+		"bool":            strictBool,
+		"md5sum":          md5Sum,
+		"sha256file":      sha256File,
+		"readJson":        readJSONFile,
+		"readYaml":        readYAMLFile,
+		"dnsSrv":          lookupSRV,
+		"dnsTxt":          lookupTXT,
+		"cidrHost":        cidrHost,
+		"sizeBytes":       sizeBytes,
+		"durationSeconds": durationSeconds,
+		"durationMillis":  durationMillis,
+		"httpGet":         fetchURL,
+		"oidcToken":       oidcToken,
+		"splitItems":      splitTrimmed,
+		"joinItems":       func(list []string, sep string) string { return strings.Join(list, sep) },
+		"jsonEscape":      jsonEscape,
+		"jsonQuote":       jsonQuote,
+		"yamlQuote":       jsonQuote,
+		"shellQuote":      shellQuote,
+		"firstItem": func(list []string) string {
+			if len(list) == 0 {
+				return ""
+			}
+			return list[0]
+		},
+	}
+}
+
+// md5Sum returns the hex MD5 digest of s.
+func md5Sum(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256File returns the hex SHA-256 digest of a file's contents.
+func sha256File(path string) (string, error) {
+	data, err := readTemplateFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readJSONFile parses a JSON file into maps, lists and scalars that
+// templates can range over.
+func readJSONFile(path string) (any, error) {
+	data, err := readTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON file %s: %w", path, err)
+	}
+	return normalizeValue(doc), nil
+}
+
+// readYAMLFile parses the first document of a YAML file like readJSONFile.
+func readYAMLFile(path string) (any, error) {
+	data, err := readTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML file %s: %w", path, err)
+	}
+	return normalizeValue(doc), nil
+}
+
+// readTemplateFile reads a file a template helper refers to.
+func readTemplateFile(path string) ([]byte, error) {
+	resolved, err := resolveTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(resolved)
+}
+
+// lookupSRV resolves an SRV record name and returns its targets as host:port
+// pairs, ordered by priority and then by target so renders are stable.
+func lookupSRV(name string) ([]string, error) {
+	resolver, err := dnsResolver()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel, err := dnsContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	_, records, err := resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		if records[i].Target != records[j].Target {
+			return records[i].Target < records[j].Target
+		}
+		return records[i].Port < records[j].Port
+	})
+	addrs := make([]string, 0, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+	return addrs, nil
+}
+
+// lookupTXT returns the TXT records of name.
+func lookupTXT(name string) ([]string, error) {
+	resolver, err := dnsResolver()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel, err := dnsContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return resolver.LookupTXT(ctx, name)
+}
+
+// strictBool parses a boolean written as 1/0, true/false, yes/no or on/off,
+// in any case, and fails on anything else, including an empty value.
+func strictBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q, must be one of 1/0, true/false, yes/no or on/off", value)
+}
+
+// splitTrimmed splits value on sep, trimming whitespace around each item and
+// dropping empty ones, so "a, b," yields [a b].
+func splitTrimmed(value, sep string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// environMap returns the rendering environment as a map.
+func environMap() map[string]string {
+	env := map[string]string{}
+	for _, kv := range renderEnviron() {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+	return env
+}
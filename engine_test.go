@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestStrictBool(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "1", want: true},
+		{value: "true", want: true},
+		{value: "TRUE", want: true},
+		{value: "Yes", want: true},
+		{value: " on ", want: true},
+		{value: "0", want: false},
+		{value: "false", want: false},
+		{value: "No", want: false},
+		{value: "OFF", want: false},
+		{value: "", wantErr: true},
+		{value: "2", wantErr: true},
+		{value: "y", wantErr: true},
+		{value: "enabled", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := strictBool(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("strictBool(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("strictBool(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("strictBool(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
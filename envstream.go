@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	// defaultEnvStreamSize is the env file size from which files are
+	// streamed instead of loaded whole.
+	defaultEnvStreamSize = 1 << 20
+	// maxEnvEntry bounds a single entry of a streamed env file.
+	maxEnvEntry = 16 << 20
+)
+
+// envStreamSize returns the size from which env files are streamed, from
+// ENVWARP_ENV_STREAM_SIZE.
+func envStreamSize() (int64, error) {
+	value := os.Getenv("ENVWARP_ENV_STREAM_SIZE")
+	if value == "" {
+		return defaultEnvStreamSize, nil
+	}
+	return parseSize(value)
+}
+
+// streamEnvFile loads a large env file in a single pass, entry by entry, so
+// memory use follows the longest entry rather than the size of the file.
+// References resolve against the environment and entries earlier in the
+// file; unlike the multi-pass loader, forward references stay empty.
+func streamEnvFile(file string, processKeys map[string]bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxEnvEntry)
+	var entry strings.Builder
+	var failures []string
+	for scanner.Scan() {
+		if entry.Len() > 0 {
+			entry.WriteByte('\n')
+		}
+		entry.WriteString(scanner.Text())
+		// Quoted values may span several lines
+		if !envEntryComplete(entry.String()) && entry.Len() < maxEnvEntry {
+			continue
+		}
+		missing, err := loadEnvEntry(file, entry.String(), processKeys)
+		if err != nil {
+			return err
+		}
+		failures = append(failures, missing...)
+		entry.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if entry.Len() > 0 {
+		missing, err := loadEnvEntry(file, entry.String(), processKeys)
+		if err != nil {
+			return err
+		}
+		failures = append(failures, missing...)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("required variables missing: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// envEntryComplete reports whether entry is a complete env file entry,
+// that is, it does not end inside a quoted value. Comment lines are always
+// complete, even if they contain an unbalanced quote.
+func envEntryComplete(entry string) bool {
+	if strings.HasPrefix(strings.TrimSpace(entry), "#") {
+		return true
+	}
+	_, value, ok := strings.Cut(entry, "=")
+	if !ok {
+		return true
+	}
+	value = strings.TrimLeft(value, " \t")
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return true
+	}
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return true
+		}
+	}
+	return false
+}
+
+// loadEnvEntry substitutes and sets the variables of a single env file
+// entry of file, returning any missing required variables.
+func loadEnvEntry(file, entry string, processKeys map[string]bool) ([]string, error) {
+	text, failures := entry, []string(nil)
+	// Most lines of a generated file hold no references, and skipping them
+	// avoids copying the whole environment for every entry.
+	if strings.Contains(entry, "$") {
+		text, failures = expandRequired(entry, nil)
+		var err error
+		if text, err = substituteVars(text); err != nil {
+			return nil, err
+		}
+	}
+	envMap, err := godotenv.Unmarshal(text)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range envMap {
+		if processKeys[key] {
+			continue // The process environment takes precedence.
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		varSources[key] = "env file " + file
+	}
+	return failures, nil
+}
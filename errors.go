@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goTemplateErrorExpr splits a text/template error into its line, column
+// and message.
+var goTemplateErrorExpr = regexp.MustCompile(`(?s)^template: .*?:(\d+)(?::(\d+))?: (.*)$`)
+
+// templateError is an error in a template file, with the position and the
+// expression it occurred at if known.
+type templateError struct {
+	file string
+	line int
+	col  int
+	expr string
+	err  error
+}
+
+func (e *templateError) Error() string {
+	pos := e.file
+	if e.line > 0 {
+		pos += ":" + strconv.Itoa(e.line)
+		if e.col > 0 {
+			pos += ":" + strconv.Itoa(e.col)
+		}
+	}
+	if e.expr != "" {
+		return fmt.Sprintf("%s: %v (in %s)", pos, e.err, e.expr)
+	}
+	return fmt.Sprintf("%s: %v", pos, e.err)
+}
+
+func (e *templateError) Unwrap() error {
+	return e.err
+}
+
+// templateErrors aggregates the errors of a whole template tree, so they can
+// all be fixed in one iteration.
+type templateErrors []*templateError
+
+func (e templateErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("%d template errors:\n  %s", len(e), strings.Join(lines, "\n  "))
+}
+
+// sort orders the errors by file and line, so reports are stable across
+// runs and can be diffed.
+func (e templateErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].file != e[j].file {
+			return e[i].file < e[j].file
+		}
+		return e[i].line < e[j].line
+	})
+}
+
+// renderFailures converts a render error of job into template errors with
+// positions relative to the template file.
+func renderFailures(job renderJob, err error) templateErrors {
+	// Streamed templates are located line by line while rendering
+	if errs, ok := err.(templateErrors); ok {
+		return errs
+	}
+	if uerr, ok := err.(*unsetVarsError); ok {
+		var errs templateErrors
+		for _, name := range uerr.names {
+			terr := &templateError{file: job.source, err: fmt.Errorf("variable %s is not set", name)}
+			if line, col, expr := referencePosition(job, name); line > 0 {
+				terr.line, terr.col, terr.expr = job.offset+line, col, expr
+			}
+			errs = append(errs, terr)
+		}
+		return errs
+	}
+
+	if job.engine == "gotemplate" {
+		terr := &templateError{file: job.source, err: err}
+		if m := goTemplateErrorExpr.FindStringSubmatch(err.Error()); m != nil {
+			terr.line, _ = strconv.Atoi(m[1])
+			terr.line += job.offset
+			terr.col, _ = strconv.Atoi(m[2])
+			terr.err = errors.New(m[3])
+		}
+		return templateErrors{terr}
+	}
+	// Conditional directives are positioned already, in the template or
+	// the include they are in.
+	var terr *templateError
+	if errors.As(err, &terr) {
+		if terr.file == job.source {
+			terr.line += job.offset
+		}
+		return templateErrors{terr}
+	}
+	if errs := envsubstFailures(job); len(errs) > 0 {
+		return errs
+	}
+	return templateErrors{{file: job.source, err: err}}
+}
+
+// referencePosition returns the line, column and text of the first body
+// reference to the variable, or a zero line if there is none.
+func referencePosition(job renderJob, name string) (int, int, string) {
+	quoted := regexp.QuoteMeta(name)
+	expr := `\$\{` + quoted + `\}|\$` + quoted + `\b`
+	if job.engine == "gotemplate" {
+		expr = `\.` + quoted + `\b`
+	}
+	re := regexp.MustCompile(expr)
+	for i, line := range strings.Split(string(job.body), "\n") {
+		if loc := re.FindStringIndex(line); loc != nil {
+			return i + 1, loc[0] + 1, line[loc[0]:loc[1]]
+		}
+	}
+	return 0, 0, ""
+}
+
+// envsubstFailures re-scans an envsubst template that failed to render and
+// returns each missing required variable and malformed expression with its
+// position, since envsubst itself only reports a message.
+func envsubstFailures(job renderJob) templateErrors {
+	var errs templateErrors
+	for i, line := range strings.Split(string(job.body), "\n") {
+		at := func(col int, expr string, err error) {
+			errs = append(errs, &templateError{file: job.source, line: job.offset + i + 1, col: col, expr: expr, err: err})
+		}
+		for _, loc := range requiredExpr.FindAllStringIndex(line, -1) {
+			expr := line[loc[0]:loc[1]]
+			if _, failures := expandRequired(expr, nil); len(failures) > 0 {
+				at(loc[0]+1, expr, errors.New(failures[0]))
+			}
+		}
+
+		text, _ := expandRequired(line, nil)
+		if _, err := substituteVars(text); err != nil {
+			if col, expr := malformedExpr(line); col > 0 {
+				at(col, expr, err)
+			} else {
+				at(0, "", err)
+			}
+		}
+	}
+	return errs
+}
+
+// malformedExpr returns the column and text of the first ${...} expression
+// on line that envsubst cannot parse, or a zero column if there is none.
+func malformedExpr(line string) (int, string) {
+	for i := 0; i < len(line)-1; i++ {
+		if line[i] != '$' {
+			continue
+		}
+		if line[i+1] == '$' {
+			i++
+			continue
+		}
+		if line[i+1] != '{' {
+			continue
+		}
+		if loc := requiredExpr.FindStringIndex(line[i:]); loc != nil && loc[0] == 0 {
+			i += loc[1] - 1
+			continue
+		}
+		expr := line[i:]
+		if end := strings.IndexByte(expr, '}'); end != -1 {
+			expr = expr[:end+1]
+		}
+		if _, err := substituteVars(expr); err != nil {
+			return i + 1, expr
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// valueEscapers are the envwarp-escape modes of envsubst templates, applied
+// to every substituted value. JSON escapes are valid in double-quoted YAML
+// scalars as well.
+var valueEscapers = map[string]func(string) string{
+	"json":  jsonEscape,
+	"yaml":  jsonEscape,
+	"shell": shellQuote,
+}
+
+// checkEscape reports an error for an unknown envwarp-escape mode.
+func checkEscape(escape string) error {
+	if _, ok := valueEscapers[escape]; escape != "" && !ok {
+		return fmt.Errorf("unknown envwarp-escape mode %q, must be json, yaml or shell", escape)
+	}
+	return nil
+}
+
+// jsonQuote returns value as a JSON string literal, quotes included. JSON
+// strings are also valid double-quoted YAML scalars.
+func jsonQuote(value string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string cannot fail.
+	enc.Encode(value)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonEscape escapes value for use inside an existing JSON string, so
+// quotes, backslashes and newlines cannot break out of it.
+func jsonEscape(value string) string {
+	quoted := jsonQuote(value)
+	return quoted[1 : len(quoted)-1]
+}
+
+// shellQuote quotes value for a POSIX shell: it is wrapped in single quotes,
+// and each embedded single quote closes the quoting, is escaped with a
+// backslash and reopens it.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultEventRetries    = 3
+	defaultEventRetryDelay = 500 * time.Millisecond
+	eventTimeout           = 5 * time.Second
+)
+
+// lifecycleEvent is posted to ENVWARP_EVENTS_URL on render and exec, so
+// deployment tooling can correlate config rollouts with incidents.
+type lifecycleEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host,omitempty"`
+	Files    int       `json:"files,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Duration float64   `json:"duration_seconds,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Command  string    `json:"command,omitempty"`
+}
+
+// eventRetryPolicy returns how often a failed event delivery is retried,
+// from ENVWARP_EVENTS_RETRIES (default 3), and the delay before the first
+// retry, from ENVWARP_EVENTS_RETRY_DELAY (default 500ms). The delay doubles
+// on every further attempt.
+func eventRetryPolicy() (int, time.Duration, error) {
+	retries, delay := defaultEventRetries, defaultEventRetryDelay
+	if value := os.Getenv("ENVWARP_EVENTS_RETRIES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_EVENTS_RETRIES %q, must be a non-negative integer", value)
+		}
+		retries = n
+	}
+	if value := os.Getenv("ENVWARP_EVENTS_RETRY_DELAY"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_EVENTS_RETRY_DELAY %q, must be a non-negative duration", value)
+		}
+		delay = d
+	}
+	return retries, delay, nil
+}
+
+// emitEvent posts a lifecycle event to ENVWARP_EVENTS_URL, if set, retrying
+// with exponential backoff on connection errors and server errors. Delivery
+// failures are only logged, so an unreachable endpoint never fails the run.
+func emitEvent(event lifecycleEvent) {
+	address := os.Getenv("ENVWARP_EVENTS_URL")
+	if address == "" {
+		return
+	}
+	if err := postEvent(address, event); err != nil {
+		log.Printf("Warning: Failed to send %s event to %s: %v", event.Event, address, err)
+	}
+}
+
+// postEvent delivers one event to address.
+func postEvent(address string, event lifecycleEvent) error {
+	retries, delay, err := eventRetryPolicy()
+	if err != nil {
+		return err
+	}
+	event.Time = time.Now().UTC()
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := httpRequest("POST", address, "application/json", body, eventTimeout)
+		if err == nil && code >= 200 && code <= 299 {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d", code)
+			// Client errors other than rate limiting will not go away
+			if code < 500 && code != 429 {
+				return err
+			}
+		}
+		if attempt > retries {
+			return err
+		}
+		log.Printf("Warning: Failed to send %s event, retrying in %s (%d/%d): %v", event.Event, delay, attempt, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// renderedEvent returns the render-success event for outputs.
+func renderedEvent(metrics *runMetrics, outputs []string) lifecycleEvent {
+	event := lifecycleEvent{Event: "render-success", Files: len(outputs), Duration: metrics.duration.Seconds()}
+	if hash, err := renderedHash(nil, outputs); err == nil {
+		event.Hash = hash
+	}
+	return event
+}
+
+// execEvent returns the exec event for running argv. Only the program name
+// is sent, since arguments may carry secrets.
+func execEvent(argv []string) lifecycleEvent {
+	return lifecycleEvent{Event: "exec", Command: filepath.Base(argv[0])}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/a8m/envsubst/parse"
+)
+
+// requiredExpr matches `$$` escapes and the ${VAR:?message} and
+// ${VAR?message} forms, which envsubst does not support.
+var requiredExpr = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:?)\?([^}]*)\}`)
+
+// expandEnv substitutes ${VAR} references in text like envsubst.String, but
+// also sees private secrets and supports ${VAR:?message}.
+func expandEnv(text string) (string, error) {
+	return expandEscaped(text, nil)
+}
+
+// expandEscaped is expandEnv with every substituted value passed through
+// escape, unless it is nil.
+func expandEscaped(text string, escape func(string) string) (string, error) {
+	text, err := checkRequired(text, escape)
+	if err != nil {
+		return "", err
+	}
+	return parse.New("string", escapedEnviron(escape), &parse.Restrictions{}).Parse(text)
+}
+
+// substituteVars runs envsubst on text against the rendering environment.
+func substituteVars(text string) (string, error) {
+	return parse.New("string", renderEnviron(), &parse.Restrictions{}).Parse(text)
+}
+
+// checkRequired is expandRequired, failing if any required variable is missing.
+func checkRequired(text string, escape func(string) string) (string, error) {
+	text, failures := expandRequired(text, escape)
+	if len(failures) > 0 {
+		return "", errors.New(strings.Join(failures, "; "))
+	}
+	return text, nil
+}
+
+// expandRequired resolves ${VAR:?message} (unset or empty) and
+// ${VAR?message} (unset) like a POSIX shell, leaving all other expansions to
+// envsubst. Resolved values are passed through escape, unless it is nil, and
+// escaped so envsubst keeps them literally. Missing variables expand to an
+// empty string and are returned as failure messages in the shell's
+// "VAR: message" format.
+func expandRequired(text string, escape func(string) string) (string, []string) {
+	var failures []string
+	text = requiredExpr.ReplaceAllStringFunc(text, func(match string) string {
+		if match == "$$" {
+			return match
+		}
+		m := requiredExpr.FindStringSubmatch(match)
+		name, colon, message := m[1], m[2] == ":", m[3]
+		value, ok := privateSecrets[name]
+		if !ok {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok || (colon && value == "") {
+			if message == "" {
+				message = "parameter null or not set"
+			}
+			failures = append(failures, name+": "+message)
+			return ""
+		}
+		if escape != nil {
+			value = escape(value)
+		}
+		return strings.ReplaceAll(value, "$", "$$")
+	})
+	return text, failures
+}
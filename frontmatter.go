@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// frontMatterLine matches a header directive such as `# envwarp-tags: web`.
+// Common comment prefixes are allowed, and a trailing `-->` or `*/` is ignored.
+var frontMatterLine = regexp.MustCompile(`^\s*(?:#|//|;|--|<!--|/\*|\{#)?\s*envwarp-([a-z-]+):\s*(.*?)\s*(?:-->|\*/)?\s*$`)
+
+// frontMatter holds the directives declared at the top of a template.
+type frontMatter map[string]string
+
+// parseFrontMatter extracts envwarp directives from the leading lines of a
+// template and returns them together with the remaining content.
+func parseFrontMatter(content []byte) (frontMatter, []byte) {
+	fm := frontMatter{}
+	rest := content
+	for len(rest) > 0 {
+		line := rest
+		next := []byte(nil)
+		if idx := bytes.IndexByte(rest, '\n'); idx != -1 {
+			line, next = rest[:idx], rest[idx+1:]
+		}
+		m := frontMatterLine.FindSubmatch(bytes.TrimSuffix(line, []byte("\r")))
+		if m == nil {
+			break
+		}
+		fm[string(m[1])] = string(m[2])
+		rest = next
+	}
+	return fm, rest
+}
+
+// tags returns the tags declared via envwarp-tags.
+func (fm frontMatter) tags() []string {
+	return splitList(fm["tags"])
+}
+
+// directives reports whether #include and #if directive lines are processed
+// in an envsubst template: its envwarp-directives header if present, otherwise
+// ENVWARP_DIRECTIVES. They are off by default, so such lines in nginx or C
+// style configs pass through untouched.
+func (fm frontMatter) directives() bool {
+	if value, ok := fm["directives"]; ok {
+		return enabledValue(value)
+	}
+	return envEnabled("ENVWARP_DIRECTIVES")
+}
+
+// selectedTags returns the tags selected via ENVWARP_TAGS or --tags.
+func selectedTags() []string {
+	return splitList(os.Getenv("ENVWARP_TAGS"))
+}
+
+// shouldRender reports whether a template with the given tags is selected.
+// Untagged templates are always rendered, as are all templates when no tags
+// are selected.
+func shouldRender(tags, selected []string) bool {
+	if len(tags) == 0 || len(selected) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, s := range selected {
+			if tag == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// prepareDirs creates the directories declared in ENVWARP_MKDIRS and applies
+// their owner and mode. Each comma-separated entry has the form
+// path[:uid[:gid[:mode]]], where empty fields are left unchanged.
+func prepareDirs() error {
+	spec := os.Getenv("ENVWARP_MKDIRS")
+	if spec == "" {
+		return nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) > 4 {
+			return fmt.Errorf("invalid ENVWARP_MKDIRS entry %q, expected path[:uid[:gid[:mode]]]", entry)
+		}
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		path := fields[0]
+
+		uid, err := parseID(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid uid in ENVWARP_MKDIRS entry %q: %w", entry, err)
+		}
+		gid, err := parseID(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid gid in ENVWARP_MKDIRS entry %q: %w", entry, err)
+		}
+
+		mode := os.FileMode(0755)
+		if fields[3] != "" {
+			m, err := strconv.ParseUint(fields[3], 8, 32)
+			if err != nil {
+				return fmt.Errorf("invalid mode in ENVWARP_MKDIRS entry %q: %w", entry, err)
+			}
+			mode = os.FileMode(m)
+		}
+
+		if err := os.MkdirAll(path, mode); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", path, err)
+		}
+		// MkdirAll is subject to the umask and skips existing directories.
+		if fields[3] != "" {
+			if err := os.Chmod(path, mode); err != nil {
+				return fmt.Errorf("failed to set mode on '%s': %w", path, err)
+			}
+		}
+		if uid != -1 || gid != -1 {
+			if err := os.Chown(path, uid, gid); err != nil {
+				return fmt.Errorf("failed to set owner on '%s': %w", path, err)
+			}
+		}
+		log.Printf("Prepared directory: %s", path)
+	}
+	return nil
+}
+
+// parseID parses a numeric uid or gid, returning -1 for an empty value.
+func parseID(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("%q is not a valid numeric id", value)
+	}
+	return id, nil
+}
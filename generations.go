@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	currentLink        = "current"
+	generationLayout   = "20060102T150405.000000000Z"
+	defaultGenerations = 5
+)
+
+var generationName = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z$`)
+
+// generationsEnabled reports whether ENVWARP_GENERATIONS is enabled.
+func generationsEnabled() bool {
+	return envEnabled("ENVWARP_GENERATIONS")
+}
+
+// renderConfig renders the templates into confDir. With ENVWARP_GENERATIONS,
+// each render goes into a new timestamped directory under confDir and the
+// confDir/current symlink is atomically switched to it once rendering has
+// succeeded, so readers never see a half-written generation.
+func renderConfig(templatePath, confDir string) ([]string, error) {
+	if !generationsEnabled() || confDir == stdoutDir {
+		return renderAll(templatePath, confDir)
+	}
+
+	genDir := filepath.Join(confDir, time.Now().UTC().Format(generationLayout))
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create generation directory '%s': %w", genDir, err)
+	}
+	outputs, err := renderAll(templatePath, genDir)
+	if err != nil {
+		os.RemoveAll(genDir)
+		return nil, err
+	}
+	if err := activateGeneration(confDir, filepath.Base(genDir)); err != nil {
+		return nil, err
+	}
+	log.Printf("Activated generation: %s", genDir)
+	return outputs, nil
+}
+
+// pruneAfterRender prunes old generations once the new one has passed
+// validation, so a rollback can still restore the previous generation.
+func pruneAfterRender(confDir string) {
+	if !generationsEnabled() || confDir == stdoutDir {
+		return
+	}
+	if err := pruneGenerations(confDir); err != nil {
+		log.Printf("Warning: Failed to prune old generations: %v", err)
+	}
+}
+
+// activateGeneration points confDir/current at the named generation by
+// renaming a fresh symlink over the old one.
+func activateGeneration(confDir, name string) error {
+	link := filepath.Join(confDir, currentLink)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(name, tmp); err != nil {
+		return fmt.Errorf("failed to create symlink %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to switch %s to %s: %w", link, name, err)
+	}
+	return nil
+}
+
+// currentGeneration returns the generation confDir/current points at, or ""
+// if there is none yet.
+func currentGeneration(confDir string) (string, error) {
+	target, err := os.Readlink(filepath.Join(confDir, currentLink))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return target, err
+}
+
+// activeConfDir returns the directory holding the live config, which is the
+// current generation when generations are enabled.
+func activeConfDir(confDir string) string {
+	if generationsEnabled() {
+		if current, err := currentGeneration(confDir); err == nil && current != "" {
+			return filepath.Join(confDir, current)
+		}
+		return filepath.Join(confDir, currentLink)
+	}
+	return confDir
+}
+
+// pruneGenerations removes the oldest generations beyond
+// ENVWARP_GENERATIONS_KEEP (default 5), never removing the current one.
+func pruneGenerations(confDir string) error {
+	keep := defaultGenerations
+	if value := os.Getenv("ENVWARP_GENERATIONS_KEEP"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid ENVWARP_GENERATIONS_KEEP %q", value)
+		}
+		keep = n
+	}
+
+	entries, err := os.ReadDir(confDir)
+	if err != nil {
+		return err
+	}
+	current, err := currentGeneration(confDir)
+	if err != nil {
+		return err
+	}
+
+	var generations []string
+	for _, entry := range entries {
+		if entry.IsDir() && generationName.MatchString(entry.Name()) {
+			generations = append(generations, entry.Name())
+		}
+	}
+	sort.Strings(generations)
+	for i := 0; i < len(generations)-keep; i++ {
+		if generations[i] == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(confDir, generations[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,23 @@ module Lanrenbang/envwarp
 go 1.25.3
 
 require (
-	github.com/a8m/envsubst v1.4.3 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/Masterminds/sprig/v3 v3.3.0
+	github.com/a8m/envsubst v1.4.3
+	github.com/beevik/etree v1.8.1
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/sys v0.38.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	dario.cat/mergo v1.0.1 // indirect
+	github.com/Masterminds/goutils v1.1.1 // indirect
+	github.com/Masterminds/semver/v3 v3.3.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/huandu/xstrings v1.5.0 // indirect
+	github.com/mitchellh/copystructure v1.2.0 // indirect
+	github.com/mitchellh/reflectwalk v1.0.2 // indirect
+	github.com/shopspring/decimal v1.4.0 // indirect
+	github.com/spf13/cast v1.7.0 // indirect
+	golang.org/x/crypto v0.26.0 // indirect
 )
@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+	// sockFilterSize is the size of struct sock_filter.
+	sockFilterSize = 8
+)
+
+// applyHardening sets PR_SET_NO_NEW_PRIVS and loads the seccomp filter from
+// ENVWARP_SECCOMP_PROFILE. Both are per-thread attributes, so the caller must
+// lock the OS thread and exec from it.
+func applyHardening() error {
+	profile := os.Getenv("ENVWARP_SECCOMP_PROFILE")
+	// Unprivileged processes may only load a seccomp filter with no_new_privs set.
+	if envEnabled("ENVWARP_NO_NEW_PRIVS") || profile != "" {
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+			return fmt.Errorf("failed to set no_new_privs: %w", errno)
+		}
+		log.Println("Set no_new_privs")
+	}
+	if profile == "" {
+		return nil
+	}
+
+	filter, err := readSeccompFilter(profile)
+	if err != nil {
+		return err
+	}
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("failed to load seccomp profile %s: %w", profile, errno)
+	}
+	log.Printf("Loaded seccomp profile: %s (%d instructions)", profile, len(filter))
+	return nil
+}
+
+// readSeccompFilter reads a compiled BPF program, i.e. an array of
+// struct sock_filter in native byte order.
+func readSeccompFilter(path string) ([]syscall.SockFilter, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seccomp profile %s: %w", path, err)
+	}
+	if len(content) == 0 || len(content)%sockFilterSize != 0 {
+		return nil, fmt.Errorf("invalid seccomp profile %s: size must be a non-zero multiple of %d bytes", path, sockFilterSize)
+	}
+	count := len(content) / sockFilterSize
+	if count > 0xffff {
+		return nil, fmt.Errorf("invalid seccomp profile %s: too many instructions", path)
+	}
+
+	filter := make([]syscall.SockFilter, count)
+	for i := range filter {
+		b := content[i*sockFilterSize:]
+		filter[i] = syscall.SockFilter{
+			Code: binary.NativeEndian.Uint16(b[0:2]),
+			Jt:   b[2],
+			Jf:   b[3],
+			K:    binary.NativeEndian.Uint32(b[4:8]),
+		}
+	}
+	return filter, nil
+}
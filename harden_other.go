@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// applyHardening is only supported on Linux.
+func applyHardening() error {
+	if envEnabled("ENVWARP_NO_NEW_PRIVS") || os.Getenv("ENVWARP_SECCOMP_PROFILE") != "" {
+		return errors.New("no_new_privs and seccomp are only supported on linux")
+	}
+	return nil
+}
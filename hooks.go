@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockPollInterval = 500 * time.Millisecond
+
+// runPreExecHooks runs ENVWARP_PRE_EXEC to completion before the command is
+// executed. If ENVWARP_LOCK_FILE is set, the hook is gated by an exclusive
+// lock on that file, so replicas run it one at a time. With ENVWARP_LOCK_ID,
+// a successful run is also recorded in it: the replica holding the lock runs
+// the hook unless it already succeeded for that id, while others wait for
+// the lock. A replica that gets the lock after a failed or interrupted run
+// runs the hook itself.
+func runPreExecHooks(customEnv []string) error {
+	hook := os.Getenv("ENVWARP_PRE_EXEC")
+	if hook == "" {
+		return nil
+	}
+
+	lockPath := os.Getenv("ENVWARP_LOCK_FILE")
+	if lockPath == "" {
+		return runHook("pre-exec", hook, customEnv)
+	}
+
+	var timeout time.Duration
+	if value := os.Getenv("ENVWARP_LOCK_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid ENVWARP_LOCK_TIMEOUT %q: %w", value, err)
+		}
+		timeout = d
+	}
+
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file %s: %w", lockPath, err)
+	}
+	defer f.Close()
+
+	acquired, err := tryLock(f)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", lockPath, err)
+	}
+	if !acquired {
+		// Another replica is running the hook, wait until it releases the lock.
+		log.Printf("Lock %s is held by another instance, waiting", lockPath)
+		start := time.Now()
+		for !acquired {
+			if timeout > 0 && time.Since(start) > timeout {
+				return fmt.Errorf("timed out after %s waiting for lock %s", timeout, lockPath)
+			}
+			time.Sleep(lockPollInterval)
+			if acquired, err = tryLock(f); err != nil {
+				return fmt.Errorf("failed to lock %s: %w", lockPath, err)
+			}
+		}
+	}
+	defer unlock(f)
+
+	// Without an id, there is no way to tell a new release from a restart,
+	// so the hook runs every time
+	id := os.Getenv("ENVWARP_LOCK_ID")
+	if id == "" {
+		log.Printf("Acquired lock %s, running pre-exec hook", lockPath)
+		return runHook("pre-exec", hook, customEnv)
+	}
+	marker := hookMarker(id)
+	done, err := hookSucceeded(f, marker)
+	if err != nil {
+		return fmt.Errorf("failed to read lock file %s: %w", lockPath, err)
+	}
+	if done {
+		log.Printf("Pre-exec hook already succeeded according to %s, skipping", lockPath)
+		return nil
+	}
+	log.Printf("Acquired lock %s, running pre-exec hook", lockPath)
+	if err := runHook("pre-exec", hook, customEnv); err != nil {
+		return err
+	}
+	if err := recordHookSuccess(f, marker); err != nil {
+		return fmt.Errorf("failed to record hook success in %s: %w", lockPath, err)
+	}
+	return nil
+}
+
+// hookMarker identifies a successful hook run for id, the ENVWARP_LOCK_ID,
+// in the lock file. It is hashed so the id is not written to the shared
+// volume as is.
+func hookMarker(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// hookSucceeded reports whether the lock file records a successful run with
+// marker.
+func hookSucceeded(f *os.File, marker string) (bool, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return false, err
+	}
+	first, _, _ := strings.Cut(string(content), "\n")
+	return first == marker, nil
+}
+
+// recordHookSuccess replaces the lock file content with marker and the time
+// of the run.
+func recordHookSuccess(f *os.File, marker string) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(marker+"\n"+time.Now().UTC().Format(time.RFC3339)+"\n"), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// runPostExitHook runs ENVWARP_POST_EXIT once a supervised command has
+// exited, with its exit code in ENVWARP_EXIT_CODE.
+func runPostExitHook(customEnv []string, code int) error {
+	hook := os.Getenv("ENVWARP_POST_EXIT")
+	if hook == "" {
+		return nil
+	}
+	defer cleanupScratch()
+	return runHook("post-exit", hook, exportEnv(customEnv, "ENVWARP_EXIT_CODE", strconv.Itoa(code)))
+}
+
+// runHook runs a command to completion with the child environment.
+func runHook(kind, command string, customEnv []string) error {
+	// Hooks get the scratch directory for downloads and checkouts, which is
+	// removed before the command starts
+	scratch, err := scratchDir()
+	if err != nil {
+		return err
+	}
+	parts, err := splitCommand(command)
+	if err != nil {
+		return fmt.Errorf("invalid %s hook: %w", kind, err)
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	log.Printf("Running %s hook: %s", kind, command)
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = append(childEnvironment(customEnv), "ENVWARP_SCRATCH_DIR="+scratch)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpRequest sends a request with body to an http:// URL over a plain TCP
+// connection, like the HTTP health check, and returns the response status
+// code. User info in the URL is sent as basic auth. HTTPS is not supported,
+// to keep the binary small.
+func httpRequest(method, address, contentType string, body []byte, timeout time.Duration) (int, error) {
+	host, path, auth, err := httpTarget(address)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := dialTCP(withDefaultPort(host, "80"), timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	req := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\n%sContent-Type: %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", method, path, host, auth, contentType, len(body))
+	if _, err := conn.Write(append([]byte(req), body...)); err != nil {
+		return 0, err
+	}
+	return readStatus(bufio.NewReader(conn))
+}
+
+// httpGet sends a GET request with extra "Name: value" header lines to an
+// http:// URL and returns the response body, failing on a non-2xx status or
+// a body larger than limit. It speaks HTTP/1.0, so the body is never chunked
+// and ends when the server closes the connection.
+func httpGet(address string, headers []string, limit int64, timeout time.Duration) ([]byte, error) {
+	host, path, auth, err := httpTarget(address)
+	if err != nil {
+		return nil, err
+	}
+	var extra strings.Builder
+	for _, header := range headers {
+		name, _, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" || strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q, must be Name: value", header)
+		}
+		extra.WriteString(header + "\r\n")
+	}
+
+	conn, err := dialTCP(withDefaultPort(host, "80"), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	req := fmt.Sprintf("GET %s HTTP/1.0\r\nHost: %s\r\n%s%s\r\n", path, host, auth, extra.String())
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	code, err := readStatus(r)
+	if err != nil {
+		return nil, err
+	}
+	if code < 200 || code > 299 {
+		return nil, fmt.Errorf("unexpected status code %d", code)
+	}
+	if _, err := textproto.NewReader(r).ReadMIMEHeader(); err != nil {
+		return nil, fmt.Errorf("invalid response headers: %w", err)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response body larger than %d bytes", limit)
+	}
+	return body, nil
+}
+
+// httpTarget splits an http:// URL into its host and path, and turns user
+// info into a basic auth header line.
+func httpTarget(address string) (host, path, auth string, err error) {
+	if strings.HasPrefix(address, "https://") {
+		return "", "", "", errors.New("https is not supported, use http")
+	}
+	target, ok := strings.CutPrefix(address, "http://")
+	if !ok {
+		return "", "", "", fmt.Errorf("invalid URL %q, must start with http://", address)
+	}
+	host, path = target, "/"
+	if idx := strings.Index(target, "/"); idx != -1 {
+		host = target[:idx]
+		path = target[idx:]
+	}
+	if userinfo, rest, ok := strings.Cut(host, "@"); ok {
+		host = rest
+		auth = "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo)) + "\r\n"
+	}
+	return host, path, auth, nil
+}
+
+// readStatus reads the status line of a response and returns its code.
+func readStatus(r *bufio.Reader) (int, error) {
+	statusLine, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.SplitN(strings.TrimSpace(statusLine), " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") {
+		return 0, fmt.Errorf("invalid status line %q", statusLine)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid status code %q", parts[1])
+	}
+	return code, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// includeDirective matches an envsubst-mode include line: #include "path".
+var includeDirective = regexp.MustCompile(`(?m)^[ \t]*#include[ \t]+"([^"]+)"[ \t]*\r?$`)
+
+// maxIncludeDepth bounds nested includes, which also stops include cycles.
+const maxIncludeDepth = 16
+
+// readInclude reads a partial referenced by a template. The path resolves
+// like other template file helpers and must stay inside an allowed root.
+func readInclude(path string, depth int) ([]byte, error) {
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("include %s: nested more than %d levels deep", path, maxIncludeDepth)
+	}
+	resolved, err := resolveTemplateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+	var content []byte
+	err = retryFS(resolved, func() (err error) {
+		content, err = os.ReadFile(resolved)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// expandIncludes replaces every #include "path" line in body with the
+// content of the file, recursively, before variables are substituted.
+// Conditionals in included files are processed as well.
+func expandIncludes(body []byte, depth int) ([]byte, error) {
+	var firstErr error
+	out := includeDirective.ReplaceAllFunc(body, func(line []byte) []byte {
+		if firstErr != nil {
+			return nil
+		}
+		path := string(includeDirective.FindSubmatch(line)[1])
+		content, err := readInclude(path, depth)
+		if err == nil {
+			content, err = expandConditionals(path, content)
+		}
+		if err == nil {
+			content, err = expandIncludes(content, depth+1)
+		}
+		if err != nil {
+			firstErr = err
+			return nil
+		}
+		// The directive's own newline is not part of the match.
+		if n := len(content); n > 0 && content[n-1] == '\n' {
+			content = content[:n-1]
+		}
+		return content
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
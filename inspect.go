@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template/parse"
+)
+
+// varReferenceExpr matches $$ escapes, ${NAME...} and $NAME references.
+var varReferenceExpr = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)([^}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// varSources records where variables loaded by envwarp came from, so
+// inspect can tell env files and secret files from the process environment.
+var varSources = map[string]string{}
+
+// varReference is a variable referenced by a template.
+type varReference struct {
+	name       string
+	hasDefault bool
+}
+
+// inspectedVar is a line of the inspect report.
+type inspectedVar struct {
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Source    string   `json:"source"`
+	Templates []string `json:"templates"`
+}
+
+// runInspect lists every variable referenced by the templates, whether it
+// is set and where its value comes from, without rendering anything.
+// Values are never printed. It exits with 1 if a variable without a default
+// is unset, 2 on errors and 0 otherwise.
+func runInspect(args []string) {
+	var envFiles, templateFlags stringSlice
+	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectCmd.Var(&envFiles, "e", "path to a custom environment file (can be specified multiple times)")
+	inspectCmd.Var(&envFiles, "env", "path to a custom environment file (can be specified multiple times)")
+	inspectCmd.Var(&templateFlags, "template", "template file or directory to render (can be specified multiple times, overrides ENVWARP_TEMPLATE)")
+	tagsFlag := inspectCmd.String("tags", "", "comma-separated template tags to render (overrides ENVWARP_TAGS)")
+	extFlag := inspectCmd.String("template-ext", "", "comma-separated template file extensions (overrides ENVWARP_TEMPLATE_EXT)")
+	jsonFlag := inspectCmd.Bool("json", false, "print the report as JSON")
+	inspectCmd.Parse(args)
+	setTemplateFlag(templateFlags)
+	setEnvFlag("ENVWARP_TAGS", *tagsFlag)
+	setEnvFlag("ENVWARP_TEMPLATE_EXT", *extFlag)
+
+	if len(envFiles) > 0 {
+		if err := loadEnvFiles(envFiles); err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(2)
+		}
+	}
+	if err := processSecrets(""); err != nil {
+		log.Printf("Error: Failed to process secrets: %v", err)
+		os.Exit(2)
+	}
+
+	templatePath := os.Getenv("ENVWARP_TEMPLATE")
+	if inspectCmd.NArg() > 0 {
+		templatePath = inspectCmd.Arg(0)
+	}
+	if templatePath == "" {
+		log.Print("Error: ENVWARP_TEMPLATE environment variable must be set.")
+		os.Exit(2)
+	}
+
+	// Broken templates are reported, but do not hide the others' variables
+	jobs, err := planTemplates(templatePath, stdoutDir)
+	if failures, ok := err.(templateErrors); ok {
+		for _, failure := range failures {
+			log.Printf("Warning: %v", failure)
+		}
+	} else if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(2)
+	}
+
+	report := inspectJobs(jobs)
+	if *jsonFlag {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Printf("Error: Failed to encode inspect report: %v", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(out))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VARIABLE\tSTATUS\tSOURCE\tTEMPLATES")
+		for _, v := range report {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Name, v.Status, v.Source, strings.Join(v.Templates, ", "))
+		}
+		w.Flush()
+	}
+
+	for _, v := range report {
+		if v.Status == "unset" {
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+// inspectJobs collects the variables referenced by jobs, sorted by name.
+func inspectJobs(jobs []renderJob) []inspectedVar {
+	templates := map[string]map[string]bool{}
+	required := map[string]bool{}
+	for _, job := range jobs {
+		if job.binary {
+			continue
+		}
+		refs, err := templateReferences(job)
+		if err != nil {
+			log.Printf("Warning: %s: %v", job.source, err)
+		}
+		for _, ref := range refs {
+			if templates[ref.name] == nil {
+				templates[ref.name] = map[string]bool{}
+			}
+			templates[ref.name][job.source] = true
+			if !ref.hasDefault {
+				required[ref.name] = true
+			}
+		}
+	}
+
+	report := make([]inspectedVar, 0, len(templates))
+	for name, sources := range templates {
+		v := inspectedVar{Name: name, Status: "unset", Source: "-"}
+		_, private := privateSecrets[name]
+		_, set := os.LookupEnv(name)
+		switch {
+		case private || set:
+			v.Status, v.Source = "set", "process env"
+			if source, ok := varSources[name]; ok {
+				v.Source = source
+			}
+		case !required[name]:
+			v.Status = "default"
+		}
+		for source := range sources {
+			v.Templates = append(v.Templates, source)
+		}
+		sort.Strings(v.Templates)
+		report = append(report, v)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+	return report
+}
+
+// templateReferences returns the variables a template references.
+func templateReferences(job renderJob) ([]varReference, error) {
+	if job.stream {
+		return streamReferences(job)
+	}
+	if job.engine == "gotemplate" {
+		return goTemplateReferences(job.source, job.body)
+	}
+	if !job.directives {
+		return envsubstReferences(string(job.body)), nil
+	}
+	body, err := expandIncludes(job.body, 0)
+	if err != nil {
+		body = job.body
+	}
+	return envsubstReferences(string(body)), err
+}
+
+// streamReferences returns the references of a streamed template, scanning
+// it line by line.
+func streamReferences(job renderJob) ([]varReference, error) {
+	f, err := os.Open(job.source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(job.start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var refs []varReference
+	var firstErr error
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			body := line
+			if job.directives {
+				var ierr error
+				if body, ierr = expandIncludes(line, 0); ierr != nil {
+					body = line
+					if firstErr == nil {
+						firstErr = ierr
+					}
+				}
+			}
+			refs = append(refs, envsubstReferences(string(body))...)
+		}
+		if err == io.EOF {
+			return refs, firstErr
+		}
+		if err != nil {
+			return refs, err
+		}
+	}
+}
+
+// envsubstReferences returns the ${NAME} and $NAME references in text,
+// including those nested in default values.
+func envsubstReferences(text string) []varReference {
+	var refs []varReference
+	for _, m := range varReferenceExpr.FindAllStringSubmatch(text, -1) {
+		switch {
+		case m[1] != "":
+			modifier := m[2]
+			hasDefault := strings.HasPrefix(modifier, "-") || strings.HasPrefix(modifier, ":-") ||
+				strings.HasPrefix(modifier, "=") || strings.HasPrefix(modifier, ":=")
+			refs = append(refs, varReference{name: m[1], hasDefault: hasDefault})
+			// The match ends at the first closing brace, so a nested
+			// ${NAME} in the default lost its own; restore it. Variables in
+			// a default are as optional as the one they stand in for.
+			for _, nested := range envsubstReferences(modifier + "}") {
+				nested.hasDefault = nested.hasDefault || hasDefault
+				refs = append(refs, nested)
+			}
+		case m[3] != "":
+			refs = append(refs, varReference{name: m[3]})
+		}
+	}
+	return refs
+}
+
+// goTemplateReferences returns the {{ .NAME }}, {{ $.NAME }} and
+// {{ env "NAME" }} references of a Go template.
+func goTemplateReferences(name string, body []byte) ([]varReference, error) {
+	// Functions only need to be known by name to parse the template
+	funcs := templateFuncs()
+	funcs["include"] = func(string) string { return "" }
+	trees, err := parse.Parse(name, string(body), "", "", map[string]any(funcs))
+	if err != nil {
+		return nil, err
+	}
+	var refs []varReference
+	for _, tree := range trees {
+		collectGoReferences(tree.Root, true, &refs)
+	}
+	return refs, nil
+}
+
+// collectGoReferences walks a template parse tree. Fields of the dot only
+// refer to variables where the dot is still the environment, outside the
+// bodies of range and with.
+func collectGoReferences(node parse.Node, dotIsEnv bool, refs *[]varReference) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectGoReferences(child, dotIsEnv, refs)
+		}
+	case *parse.ActionNode:
+		collectGoReferences(n.Pipe, dotIsEnv, refs)
+	case *parse.IfNode:
+		collectGoReferences(n.Pipe, dotIsEnv, refs)
+		collectGoReferences(n.List, dotIsEnv, refs)
+		collectGoReferences(n.ElseList, dotIsEnv, refs)
+	case *parse.RangeNode:
+		collectGoReferences(n.Pipe, dotIsEnv, refs)
+		collectGoReferences(n.List, false, refs)
+		collectGoReferences(n.ElseList, dotIsEnv, refs)
+	case *parse.WithNode:
+		collectGoReferences(n.Pipe, dotIsEnv, refs)
+		collectGoReferences(n.List, false, refs)
+		collectGoReferences(n.ElseList, dotIsEnv, refs)
+	case *parse.TemplateNode:
+		collectGoReferences(n.Pipe, dotIsEnv, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectGoReferences(cmd, dotIsEnv, refs)
+		}
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			if id, ok := arg.(*parse.IdentifierNode); ok && id.Ident == "env" && i+1 < len(n.Args) {
+				if s, ok := n.Args[i+1].(*parse.StringNode); ok {
+					*refs = append(*refs, varReference{name: s.Text})
+				}
+			}
+			collectGoReferences(arg, dotIsEnv, refs)
+		}
+	case *parse.FieldNode:
+		if dotIsEnv {
+			*refs = append(*refs, varReference{name: n.Ident[0]})
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			*refs = append(*refs, varReference{name: n.Ident[1]})
+		}
+	case *parse.ChainNode:
+		collectGoReferences(n.Node, dotIsEnv, refs)
+	}
+}
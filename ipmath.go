@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strconv"
+)
+
+// cidrHost returns the address of host number hostnum in the network cidr,
+// like Terraform's cidrhost: cidrHost "10.0.0.0/24" 5 is 10.0.0.5, and
+// negative numbers count back from the end of the range. The number may be
+// given as a string, so environment variables can be passed directly.
+func cidrHost(cidr string, hostnum any) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR %q", cidr)
+	}
+	prefix = prefix.Masked()
+	n, err := intArg(hostnum)
+	if err != nil {
+		return "", err
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+	num := big.NewInt(n)
+	if n < 0 {
+		num.Add(num, size)
+	}
+	if num.Sign() < 0 || num.Cmp(size) >= 0 {
+		return "", fmt.Errorf("host number %d is outside %s", n, prefix)
+	}
+
+	base := prefix.Addr().AsSlice()
+	sum := new(big.Int).Add(new(big.Int).SetBytes(base), num).Bytes()
+	addr := make([]byte, len(base))
+	copy(addr[len(addr)-len(sum):], sum)
+	ip, _ := netip.AddrFromSlice(addr)
+	return ip.String(), nil
+}
+
+// intArg converts a template argument holding an integer or an integer
+// string to an int64.
+func intArg(v any) (int64, error) {
+	switch val := v.(type) {
+	case int:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case string:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", val)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid number %v", v)
+}
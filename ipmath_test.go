@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestCIDRHost(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		hostnum any
+		want    string
+		wantErr bool
+	}{
+		{cidr: "10.0.0.0/24", hostnum: 5, want: "10.0.0.5"},
+		{cidr: "10.0.0.0/24", hostnum: "5", want: "10.0.0.5"},
+		{cidr: "10.0.0.0/24", hostnum: int64(0), want: "10.0.0.0"},
+		{cidr: "10.0.0.0/24", hostnum: -1, want: "10.0.0.255"},
+		{cidr: "10.0.0.0/24", hostnum: -256, want: "10.0.0.0"},
+		{cidr: "10.0.0.77/24", hostnum: 1, want: "10.0.0.1"},
+		{cidr: "10.0.1.0/23", hostnum: 300, want: "10.0.1.44"},
+		{cidr: "172.16.0.0/12", hostnum: 65536, want: "172.17.0.0"},
+		{cidr: "192.168.1.10/32", hostnum: 0, want: "192.168.1.10"},
+		{cidr: "fd00::/64", hostnum: 17, want: "fd00::11"},
+		{cidr: "fd00::/64", hostnum: -1, want: "fd00::ffff:ffff:ffff:ffff"},
+		{cidr: "10.0.0.0/24", hostnum: 256, wantErr: true},
+		{cidr: "10.0.0.0/24", hostnum: -257, wantErr: true},
+		{cidr: "10.0.0.0/24", hostnum: "five", wantErr: true},
+		{cidr: "10.0.0.0/24", hostnum: 1.5, wantErr: true},
+		{cidr: "10.0.0.0", hostnum: 1, wantErr: true},
+		{cidr: "10.0.0.0/33", hostnum: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := cidrHost(tt.cidr, tt.hostnum)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("cidrHost(%q, %v) = %q, want error", tt.cidr, tt.hostnum, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cidrHost(%q, %v) failed: %v", tt.cidr, tt.hostnum, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("cidrHost(%q, %v) = %q, want %q", tt.cidr, tt.hostnum, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// templateBaseDirs returns the directories relative template file paths
+// resolve against: each ENVWARP_TEMPLATE source, or its parent if it is a
+// single file.
+func templateBaseDirs() []string {
+	var bases []string
+	for _, base := range templateSources(os.Getenv("ENVWARP_TEMPLATE")) {
+		if fi, err := os.Stat(base); err == nil && !fi.IsDir() {
+			base = filepath.Dir(base)
+		}
+		bases = append(bases, base)
+	}
+	return bases
+}
+
+// templateFilePath joins a relative template file path to the last template
+// source containing it, so overlays can replace files of a base template set.
+func templateFilePath(path string) string {
+	bases := templateBaseDirs()
+	for i := len(bases) - 1; i >= 0; i-- {
+		candidate := filepath.Join(bases[i], path)
+		if _, err := os.Lstat(candidate); err == nil {
+			return candidate
+		}
+	}
+	if len(bases) == 0 {
+		return path
+	}
+	return filepath.Join(bases[len(bases)-1], path)
+}
+
+// allowedRoots returns the directories template helpers may read files from:
+// ENVWARP_INCLUDE_ROOTS, separated like the sources in ENVWARP_TEMPLATE,
+// defaulting to the template and output directories.
+func allowedRoots() []string {
+	if roots := templateSources(os.Getenv("ENVWARP_INCLUDE_ROOTS")); len(roots) > 0 {
+		return roots
+	}
+	roots := templateBaseDirs()
+	if confDir := os.Getenv("ENVWARP_CONFDIR"); confDir != "" && confDir != stdoutDir {
+		roots = append(roots, confDir)
+	}
+	return roots
+}
+
+// resolveTemplateFile resolves a path referenced by a template, relative to
+// the template directory, and fails unless it stays inside an allowed root
+// after following symlinks. This keeps templates from reading arbitrary
+// files such as /etc/shadow or service account tokens.
+func resolveTemplateFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = templateFilePath(path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range allowedRoots() {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if root, err = filepath.Abs(root); err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the allowed roots, see ENVWARP_INCLUDE_ROOTS", path)
+}
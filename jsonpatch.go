@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// patchDocument applies ENVWARP_PATCH_DOCUMENT to JSON or YAML content.
+// A patch document that is an array is treated as an RFC 6902 JSON Patch,
+// anything else as an RFC 7386 JSON Merge Patch. The patch document is
+// substituted with environment variables before it is parsed.
+func patchDocument(content []byte, format string) ([]byte, error) {
+	patchPath := os.Getenv("ENVWARP_PATCH_DOCUMENT")
+	if patchPath == "" {
+		return nil, fmt.Errorf("ENVWARP_PATCH_DOCUMENT must be set for %s patches", format)
+	}
+	raw, err := os.ReadFile(patchPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch document %s: %w", patchPath, err)
+	}
+	expanded, err := expandEnv(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to substitute patch document %s: %w", patchPath, err)
+	}
+	patchContent := []byte(expanded)
+	// YAML is a superset of JSON, so this accepts patch documents in either format.
+	var patch any
+	if err := yaml.Unmarshal(patchContent, &patch); err != nil {
+		return nil, fmt.Errorf("failed to parse patch document %s: %w", patchPath, err)
+	}
+	patch = normalizeValue(patch)
+
+	var doc any
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	}
+	doc = normalizeValue(doc)
+
+	if ops, ok := patch.([]any); ok {
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return nil, err
+		}
+	} else {
+		doc = applyMergePatch(doc, patch)
+	}
+
+	if format == "yaml" {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), enc.Close()
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// normalizeValue converts decoded numbers to int64 or float64 so that values
+// decoded from JSON and YAML compare equal.
+func normalizeValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalizeValue(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = normalizeValue(item)
+		}
+		return val
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case int:
+		return int64(val)
+	default:
+		return v
+	}
+}
+
+// applyMergePatch implements RFC 7386.
+func applyMergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = applyMergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// applyJSONPatch implements RFC 6902.
+func applyJSONPatch(doc any, ops []any) (any, error) {
+	for i, raw := range ops {
+		op, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("patch operation %d is not an object", i)
+		}
+		name, _ := op["op"].(string)
+		path, ok := op["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("patch operation %d has no path", i)
+		}
+
+		var err error
+		switch name {
+		case "add":
+			doc, err = pointerAdd(doc, path, op["value"])
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			if doc, _, err = pointerRemove(doc, path); err == nil {
+				doc, err = pointerAdd(doc, path, op["value"])
+			}
+		case "move", "copy":
+			from, ok := op["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("patch operation %d (%s) has no from", i, name)
+			}
+			var value any
+			if name == "move" {
+				doc, value, err = pointerRemove(doc, from)
+			} else {
+				value, err = pointerGet(doc, from)
+				value = deepCopy(value)
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "test":
+			var value any
+			if value, err = pointerGet(doc, path); err == nil && !reflect.DeepEqual(value, op["value"]) {
+				err = fmt.Errorf("value mismatch")
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s) failed: %w", i, name, path, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token. allowEnd permits "-" and len(arr) for additions.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > length || (idx == length && !allowEnd) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+func pointerGet(doc any, pointer string) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, t := range tokens {
+		switch node := cur.(type) {
+		case map[string]any:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", t)
+			}
+			cur = v
+		case []any:
+			idx, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("cannot traverse into %q", t)
+		}
+	}
+	return cur, nil
+}
+
+// pointerAdd adds value at pointer and returns the (possibly replaced) document.
+func pointerAdd(doc any, pointer string, value any) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := pointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		idx, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[idx+1:], node[idx:])
+		node[idx] = value
+		return pointerReplaceArray(doc, parentPointer, node)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", parentPointer)
+	}
+}
+
+// pointerRemove removes the value at pointer and returns the document and the removed value.
+func pointerRemove(doc any, pointer string) (any, any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := pointerGet(doc, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", last)
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []any:
+		idx, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[idx]
+		node = append(node[:idx:idx], node[idx+1:]...)
+		doc, err = pointerReplaceArray(doc, parentPointer, node)
+		return doc, v, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from %q", parentPointer)
+	}
+}
+
+// pointerReplaceArray stores a resized array back into its parent.
+func pointerReplaceArray(doc any, pointer string, arr []any) (any, error) {
+	if pointer == "" {
+		return arr, nil
+	}
+	tokens, _ := parsePointer(pointer)
+	parent, err := pointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = arr
+	case []any:
+		idx, _ := strconv.Atoi(last)
+		node[idx] = arr
+	}
+	return doc, nil
+}
+
+func deepCopy(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = deepCopy(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = deepCopy(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatchDocument(t *testing.T) {
+	t.Setenv("PATCH_PORT", "8443")
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "merge patch",
+			format:  "json",
+			content: `{"a": 1, "b": {"c": 2, "d": 3}, "e": [1, 2]}`,
+			patch:   `{"b": {"c": null, "x": true}, "e": [3], "f": "new"}`,
+			want:    "{\n  \"a\": 1,\n  \"b\": {\n    \"d\": 3,\n    \"x\": true\n  },\n  \"e\": [\n    3\n  ],\n  \"f\": \"new\"\n}\n",
+		},
+		{
+			name:    "merge patch replaces non-objects",
+			format:  "json",
+			content: `{"a": "text"}`,
+			patch:   `{"a": {"b": 1}}`,
+			want:    "{\n  \"a\": {\n    \"b\": 1\n  }\n}\n",
+		},
+		{
+			name:    "merge patch from the environment",
+			format:  "yaml",
+			content: "server:\n  port: 80\n  host: example.com\n",
+			patch:   "server:\n  port: ${PATCH_PORT}\n",
+			want:    "server:\n  host: example.com\n  port: 8443\n",
+		},
+		{
+			name:    "json patch",
+			format:  "json",
+			content: `{"list": [1, 2, 3], "obj": {"k": "v"}}`,
+			patch: `[
+				{"op": "add", "path": "/list/-", "value": 4},
+				{"op": "add", "path": "/list/0", "value": 0},
+				{"op": "remove", "path": "/list/2"},
+				{"op": "replace", "path": "/obj/k", "value": "w"},
+				{"op": "copy", "from": "/obj", "path": "/copy"},
+				{"op": "move", "from": "/obj/k", "path": "/moved"},
+				{"op": "add", "path": "/a~1b", "value": "slash"},
+				{"op": "test", "path": "/moved", "value": "w"}
+			]`,
+			want: "{\n  \"a/b\": \"slash\",\n  \"copy\": {\n    \"k\": \"w\"\n  },\n  \"list\": [\n    0,\n    1,\n    3,\n    4\n  ],\n  \"moved\": \"w\",\n  \"obj\": {}\n}\n",
+		},
+		{
+			name:    "json patch on yaml",
+			format:  "yaml",
+			content: "items:\n  - a\n  - b\n",
+			patch:   "- op: replace\n  path: /items/1\n  value: c\n",
+			want:    "items:\n  - a\n  - c\n",
+		},
+		{
+			name:    "json patch test compares numbers across formats",
+			format:  "yaml",
+			content: "port: 80\n",
+			patch:   `[{"op": "test", "path": "/port", "value": 80}]`,
+			want:    "port: 80\n",
+		},
+		{
+			name:    "failing test",
+			format:  "json",
+			content: `{"a": 1}`,
+			patch:   `[{"op": "test", "path": "/a", "value": 2}]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing path",
+			format:  "json",
+			content: `{"a": 1}`,
+			patch:   `[{"op": "remove", "path": "/b"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "index out of range",
+			format:  "json",
+			content: `{"a": [1]}`,
+			patch:   `[{"op": "add", "path": "/a/5", "value": 2}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown op",
+			format:  "json",
+			content: `{}`,
+			patch:   `[{"op": "frobnicate", "path": "/a"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid document",
+			format:  "json",
+			content: `{"a":`,
+			patch:   `{}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		patchPath := filepath.Join(t.TempDir(), "patch")
+		if err := os.WriteFile(patchPath, []byte(tt.patch), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("ENVWARP_PATCH_DOCUMENT", patchPath)
+		got, err := patchDocument([]byte(tt.content), tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: patchDocument = %q, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: patchDocument failed: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: patchDocument = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	defaultKeytabPath = "/tmp/krb5.keytab"
+	defaultCCName     = "FILE:/tmp/krb5cc_envwarp"
+)
+
+// setupKerberos obtains a Kerberos ticket via kinit using a keytab.
+// It returns the credential cache name to export as KRB5CCNAME, or an empty
+// string if Kerberos is not configured.
+func setupKerberos() (string, error) {
+	principal := os.Getenv("ENVWARP_KRB5_PRINCIPAL")
+	if principal == "" {
+		return "", nil
+	}
+
+	keytab := os.Getenv("ENVWARP_KRB5_KEYTAB")
+	if keytab == "" {
+		keytab = defaultKeytabPath
+	}
+
+	// The keytab is binary, so secret references carry it base64-encoded.
+	// Whitespace is dropped, as encoders usually wrap their output in lines.
+	if encoded := lookupVar("ENVWARP_KRB5_KEYTAB_BASE64"); encoded != "" {
+		content, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode ENVWARP_KRB5_KEYTAB_BASE64: %w", err)
+		}
+		if err := writeFileAtomic(keytab, content, 0600); err != nil {
+			return "", err
+		}
+		log.Printf("Written Kerberos keytab to: %s", keytab)
+	}
+
+	ccName := os.Getenv("ENVWARP_KRB5_CCNAME")
+	if ccName == "" {
+		ccName = defaultCCName
+	}
+
+	kinitPath, err := exec.LookPath("kinit")
+	if err != nil {
+		return "", fmt.Errorf("kinit not found in PATH: %w", err)
+	}
+
+	log.Printf("Obtaining Kerberos ticket for %s", principal)
+	cmd := exec.Command(kinitPath, "-k", "-t", keytab, principal)
+	cmd.Env = append(os.Environ(), "KRB5CCNAME="+ccName)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kinit failed for %s: %w", principal, err)
+	}
+
+	return ccName, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// sizeUnits are the accepted byte size suffixes, as binary multiples. The
+// Ki, Mi and Gi forms match Kubernetes resource quantities.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses a byte size such as 65536, 64K, 256MiB, 512Mi or 1G.
+func parseSize(value string) (int64, error) {
+	number, multiplier := strings.TrimSpace(value), int64(1)
+	for _, unit := range sizeUnits {
+		if rest, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(rest), unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// applyMemoryLimit sets the Go runtime's soft memory limit from
+// ENVWARP_MAX_MEMORY, so the garbage collector works harder before envwarp
+// grows past it. Without it the runtime still honours GOMEMLIMIT.
+func applyMemoryLimit() error {
+	value := os.Getenv("ENVWARP_MAX_MEMORY")
+	if value == "" {
+		return nil
+	}
+	limit, err := parseSize(value)
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_MAX_MEMORY: %w", err)
+	}
+	debug.SetMemoryLimit(limit)
+	return nil
+}
+
+// outputBudget caps the total size of the output of one render, from
+// ENVWARP_MAX_OUTPUT. A zero limit means no cap.
+type outputBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// newOutputBudget returns the output budget configured by ENVWARP_MAX_OUTPUT.
+func newOutputBudget() (*outputBudget, error) {
+	value := os.Getenv("ENVWARP_MAX_OUTPUT")
+	if value == "" {
+		return &outputBudget{}, nil
+	}
+	limit, err := parseSize(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENVWARP_MAX_OUTPUT: %w", err)
+	}
+	return &outputBudget{limit: limit}, nil
+}
+
+// take charges n bytes, failing once the total exceeds the limit.
+func (b *outputBudget) take(n int) error {
+	if b.limit == 0 {
+		return nil
+	}
+	if b.used.Add(int64(n)) > b.limit {
+		return fmt.Errorf("rendered output exceeds ENVWARP_MAX_OUTPUT of %d bytes", b.limit)
+	}
+	return nil
+}
+
+// release returns n previously taken bytes to the budget.
+func (b *outputBudget) release(n int) {
+	b.used.Add(-int64(n))
+}
+
+// budgetBuffer is a buffer that charges every write to a budget, so a
+// runaway template stops as soon as the budget is spent rather than after
+// it has produced all of its output.
+type budgetBuffer struct {
+	bytes.Buffer
+	budget *outputBudget
+}
+
+func (w *budgetBuffer) Write(p []byte) (int, error) {
+	if err := w.budget.take(len(p)); err != nil {
+		return 0, err
+	}
+	return w.Buffer.Write(p)
+}
+
+// Reset discards the buffer and refunds its size to the budget.
+func (w *budgetBuffer) Reset() {
+	w.budget.release(w.Len())
+	w.Buffer.Reset()
+}
+
+// budgetWriter charges every write to a budget before passing it on, for
+// streamed output that is written to disk instead of buffered.
+type budgetWriter struct {
+	w      io.Writer
+	budget *outputBudget
+}
+
+func (w *budgetWriter) Write(p []byte) (int, error) {
+	if err := w.budget.take(len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
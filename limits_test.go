@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "65536", want: 65536},
+		{value: "100B", want: 100},
+		{value: "64K", want: 64 << 10},
+		{value: "64KB", want: 64 << 10},
+		{value: "256MiB", want: 256 << 20},
+		{value: "512Mi", want: 512 << 20},
+		{value: "1G", want: 1 << 30},
+		{value: " 2 Gi ", want: 2 << 30},
+		{value: "", wantErr: true},
+		{value: "-1K", wantErr: true},
+		{value: "1.5G", wantErr: true},
+		{value: "10T", wantErr: true},
+		{value: "M", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSize(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
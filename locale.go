@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	zoneinfoDir   = "/usr/share/zoneinfo"
+	localtimePath = "/etc/localtime"
+)
+
+// setupLocale links /etc/localtime for ENVWARP_TZ and exports TZ and LANG
+// from ENVWARP_TZ and ENVWARP_LOCALE to the executed command.
+func setupLocale(childEnv []string) ([]string, error) {
+	if tz := os.Getenv("ENVWARP_TZ"); tz != "" {
+		zoneFile := filepath.Join(zoneinfoDir, tz)
+		if _, err := os.Stat(zoneFile); err != nil {
+			return childEnv, fmt.Errorf("unknown timezone %q: %w", tz, err)
+		}
+		// TZ alone is enough for most programs, so a read-only /etc is not fatal.
+		if err := replaceSymlink(zoneFile, localtimePath); err != nil {
+			log.Printf("Warning: Failed to link %s: %v", localtimePath, err)
+		} else {
+			log.Printf("Linked %s to %s", localtimePath, zoneFile)
+		}
+		childEnv = exportEnv(childEnv, "TZ", tz)
+	}
+
+	if locale := os.Getenv("ENVWARP_LOCALE"); locale != "" {
+		childEnv = exportEnv(childEnv, "LANG", locale)
+		log.Printf("Set locale to %s", locale)
+	}
+	return childEnv, nil
+}
+
+// replaceSymlink atomically points link at target, replacing whatever is there.
+func replaceSymlink(target, link string) error {
+	tmp := link + ".envwarp-tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock attempts to take an exclusive lock on f without blocking.
+func tryLock(f *os.File) (bool, error) {
+	return false, errors.New("file locks are not supported on windows")
+}
+
+func unlock(f *os.File) {}
@@ -2,20 +2,23 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/a8m/envsubst"
 	"github.com/joho/godotenv"
 )
 
@@ -42,9 +45,15 @@ func main() {
 	log.SetPrefix("[envwarp] ")
 	log.SetFlags(0)
 
+	if err := pristineEnv(); err != nil {
+		log.Fatalf("Error: Failed to re-execute with a pristine environment: %v", err)
+	}
+
 	// --- Flag definitions ---
 	var envFiles stringSlice
 	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	preferIPv4 := checkCmd.Bool("prefer-ipv4", false, "try IPv4 addresses first (same as ENVWARP_PREFER_IP=ipv4)")
+	preferIPv6 := checkCmd.Bool("prefer-ipv6", false, "try IPv6 addresses first (same as ENVWARP_PREFER_IP=ipv6)")
 
 	// Top-level flags
 	versionFlag := flag.Bool("v", false, "print version and exit")
@@ -53,12 +62,24 @@ func main() {
 	// Custom var for repeated -e/--env flags
 	flag.Var(&envFiles, "e", "path to a custom environment file (can be specified multiple times)")
 	flag.Var(&envFiles, "env", "path to a custom environment file (can be specified multiple times)")
+	var templateFlags stringSlice
+	flag.Var(&templateFlags, "template", "template file or directory to render (can be specified multiple times, overrides ENVWARP_TEMPLATE)")
+	var pairFlags stringSlice
+	flag.Var(&pairFlags, "t", "render a template to a destination, as SRC:DEST (can be specified multiple times)")
+	tagsFlag := flag.String("tags", "", "comma-separated template tags to render (overrides ENVWARP_TAGS)")
+	extFlag := flag.String("template-ext", "", "comma-separated template file extensions (overrides ENVWARP_TEMPLATE_EXT)")
+	binaryFlag := flag.String("binary", "", "how to handle binary templates: fail or copy (overrides ENVWARP_BINARY)")
+	strictFlag := flag.Bool("strict", false, "fail on unset variables referenced by templates (same as ENVWARP_STRICT=1)")
+	passthroughFlag := flag.Bool("passthrough", false, "leave references to unset variables in the output as they are (same as ENVWARP_PASSTHROUGH=1)")
+	keepTempFlag := flag.Bool("keep-temp", false, "keep the temporary directory for debugging (same as ENVWARP_KEEP_TEMP=1)")
+	dryRunFlag := flag.Bool("dry-run", false, "print a diff of the changes rendering would make and exit")
 
 	// Handle subcommands first, as they have their own logic
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "check":
 			checkCmd.Parse(os.Args[2:])
+			setPreferIPFlags(*preferIPv4, *preferIPv6)
 			address := checkCmd.Arg(0)
 			if address == "" {
 				address = os.Getenv("ENVWARP_CHECKURL")
@@ -68,11 +89,24 @@ func main() {
 			}
 			runHealthCheck(address)
 			// runHealthCheck will os.Exit
+		case "drift":
+			runDrift(os.Args[2:])
+			// runDrift will os.Exit
+		case "render":
+			runRender(os.Args[2:])
+			// runRender will os.Exit
+		case "inspect":
+			runInspect(os.Args[2:])
+			// runInspect will os.Exit
 		}
 	}
 
 	// Parse top-level flags for main logic
 	flag.Parse()
+	templatePairs, err := parseTemplatePairs(pairFlags)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
 	if *versionFlag {
 		if version == "" {
@@ -83,74 +117,378 @@ func main() {
 		os.Exit(0)
 	}
 
+	setTemplateFlag(templateFlags)
+	setEnvFlag("ENVWARP_TAGS", *tagsFlag)
+	setEnvFlag("ENVWARP_TEMPLATE_EXT", *extFlag)
+	setEnvFlag("ENVWARP_BINARY", *binaryFlag)
+	setStrictFlag(*strictFlag)
+	setPassthroughFlag(*passthroughFlag)
+	setKeepTempFlag(*keepTempFlag)
+
 	// --- Main logic starts here ---
 	var originalEnv []string
 	if len(envFiles) > 0 {
-		log.Printf("Loading custom environment files: %s", envFiles.String())
 		originalEnv = os.Environ()
+		if err := loadEnvFiles(envFiles); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
 
-		// Outer loop: process each file sequentially.
-		for _, file := range envFiles {
-			// Inner loop: process each file multiple times to resolve nested variables within the same file.
-			for i := 0; i < 5; i++ { // Limit to 5 passes to prevent infinite loops.
-				changedCounter := 0
-
-				content, err := envsubst.ReadFile(file)
-				if err != nil {
-					log.Fatalf("Error reading/substituting env file %s: %v", file, err)
-				}
-
-				envMap, err := godotenv.Unmarshal(string(content))
-				if err != nil {
-					log.Fatalf("Error unmarshaling env file %s: %v", file, err)
-				}
-
-				for key, value := range envMap {
-					oldValue := os.Getenv(key)
-					if oldValue != value {
-						changedCounter++
-					}
-					if err := os.Setenv(key, value); err != nil {
-						log.Fatalf("Error setting env var %s from file %s: %v", key, file, err)
-					}
-				}
+	if err := applyMemoryLimit(); err != nil {
+		log.Fatalf("Error: Failed to apply memory limit: %v", err)
+	}
 
-				if changedCounter == 0 {
-					break // File is stable, move to the next file.
-				}
-			}
+	// A dry run only renders and diffs, skipping every other side effect
+	if *dryRunFlag {
+		if err := processSecrets(""); err != nil {
+			log.Fatalf("Error: Failed to process secrets: %v", err)
 		}
+		os.Exit(runDryRun(os.Getenv("ENVWARP_TEMPLATE"), os.Getenv("ENVWARP_CONFDIR")))
+	}
+
+	// Wait for volumes before reading secrets or writing anything to them
+	if err := waitForPaths(); err != nil {
+		log.Fatalf("Error: Failed waiting for paths: %v", err)
 	}
 
 	// Process secrets after loading env vars
-	if err := processSecrets(); err != nil {
+	if err := processSecrets(os.Getenv("ENVWARP_SECRETS_OUTDIR")); err != nil {
 		log.Fatalf("Error: Failed to process secrets: %v", err)
 	}
 
+	if err := setupSSH(); err != nil {
+		log.Fatalf("Error: Failed to set up SSH: %v", err)
+	}
+
+	if err := setupCredentialFiles(); err != nil {
+		log.Fatalf("Error: Failed to generate credential files: %v", err)
+	}
+
+	if err := prepareDirs(); err != nil {
+		log.Fatalf("Error: Failed to prepare directories: %v", err)
+	}
+
+	if err := setupNetworkFiles(); err != nil {
+		log.Fatalf("Error: Failed to update network configuration files: %v", err)
+	}
+
+	if err := applyTuning(); err != nil {
+		log.Fatalf("Error: Failed to apply kernel tuning: %v", err)
+	}
+
+	ccName, err := setupKerberos()
+	if err != nil {
+		log.Fatalf("Error: Failed to set up Kerberos: %v", err)
+	}
+	if ccName != "" {
+		originalEnv = exportEnv(originalEnv, "KRB5CCNAME", ccName)
+	}
+
+	originalEnv, err = setupLocale(originalEnv)
+	if err != nil {
+		log.Fatalf("Error: Failed to set up timezone and locale: %v", err)
+	}
+
 	// Get required env vars
 	templatePath := os.Getenv("ENVWARP_TEMPLATE")
 	confDir := os.Getenv("ENVWARP_CONFDIR")
 
-	if templatePath == "" || confDir == "" {
+	pipelines, err := loadPipelines()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// With -t pairs or pipelines, the template directory is optional
+	hasTemplateDir := templatePath != "" || confDir != ""
+	if (hasTemplateDir || len(templatePairs) == 0 && len(pipelines) == 0) && (templatePath == "" || confDir == "") {
 		log.Fatal("Error: ENVWARP_TEMPLATE and ENVWARP_CONFDIR environment variables must be set.")
 	}
+	watch, refreshes, err := watchSettings(confDir)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Keep the previous generation around if it may need to be restored
+	var snapshot *configSnapshot
+	startupCheck := os.Getenv("ENVWARP_STARTUP_CHECK")
+	if hasTemplateDir && (os.Getenv("ENVWARP_VALIDATE") != "" || startupCheck != "") && envEnabled("ENVWARP_ROLLBACK") {
+		if snapshot, err = takeSnapshot(confDir, os.Getenv("ENVWARP_PATCH_FILE")); err != nil {
+			log.Fatalf("Error: Failed to save previous config: %v", err)
+		}
+	}
 
 	// Process templates
-	if err := processTemplates(templatePath, confDir); err != nil {
-		log.Fatalf("Error: Failed to process templates: %v", err)
+	metrics := startMetrics()
+	emitEvent(lifecycleEvent{Event: "render-start"})
+	var outputs []string
+	if hasTemplateDir {
+		if outputs, err = renderConfig(templatePath, confDir); err != nil {
+			failRender(metrics, "Error: Failed to process templates: %v", err)
+		}
+	}
+	if len(templatePairs) > 0 {
+		pairOutputs, err := processPairs(templatePairs)
+		if err != nil {
+			failRender(metrics, "Error: Failed to process templates: %v", err)
+		}
+		outputs = append(outputs, pairOutputs...)
+	}
+	if len(pipelines) > 0 {
+		pipelineOutputs, err := runPipelines(pipelines, originalEnv)
+		if err != nil {
+			failRender(metrics, "Error: Failed to process templates: %v", err)
+		}
+		outputs = append(outputs, pipelineOutputs...)
 	}
 
+	metrics.rendered(outputs)
 	log.Println("All templates processed successfully.")
 
+	if err := processPatch(); err != nil {
+		failRender(metrics, "Error: Failed to patch config file: %v", err)
+	}
+
+	if err := validateConfig(snapshot, originalEnv); err != nil {
+		failRender(metrics, "Error: Failed to validate config: %v", err)
+	}
+	// With a startup check, the previous generation is kept until it passes
+	if hasTemplateDir && (snapshot == nil || startupCheck == "") {
+		pruneAfterRender(confDir)
+	}
+	// With generations, every render starts from an empty directory anyway
+	if pruneEnabled() && hasTemplateDir && !generationsEnabled() {
+		if err := pruneStale(confDir, outputs); err != nil {
+			log.Printf("Warning: Failed to prune stale files: %v", err)
+		}
+	}
+	if err := writeManifest(outputs); err != nil {
+		log.Printf("Warning: Failed to write render manifest: %v", err)
+	}
+	emitEvent(renderedEvent(metrics, outputs))
+
 	// Execute next command if specified
-	executionCmd := os.Getenv("ENVWARP_EXECUTION")
-	if executionCmd != "" {
-		executeCommand(executionCmd, originalEnv)
+	argv, err := executionArgs()
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	// Watch mode renders again after the secrets left the environment
+	var retained map[string]string
+	if watch > 0 || len(refreshes) > 0 {
+		retained = retainSecrets()
+	}
+	originalEnv, err = exportMemfdSecrets(augmentPath(originalEnv))
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	originalEnv = exportSecrets(originalEnv)
+	restoreSecrets(retained)
+	if originalEnv, err = passOnlyEnv(originalEnv); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	if err := runPreExecHooks(originalEnv); err != nil {
+		fatalf("Error: %v", err)
+	}
+	cleanupScratch()
+
+	// Init and migration jobs run once per rendered configuration
+	if marker := os.Getenv("ENVWARP_ONESHOT_MARKER"); marker != "" {
+		runOneshot(marker, argv, originalEnv, outputs, metrics)
+	}
+
+	// In watch mode, envwarp stays resident to re-render the config
+	if watch > 0 || len(refreshes) > 0 {
+		runWatch(watch, refreshes, argv, originalEnv, outputs, func() ([]string, error) {
+			return rerender(templatePath, confDir, templatePairs, originalEnv)
+		})
+	}
+
+	// With a crontab, envwarp stays resident to run jobs next to the command
+	if crontab := os.Getenv("ENVWARP_CRONTAB"); crontab != "" {
+		runScheduler(crontab, argv, originalEnv)
+	}
+
+	if len(argv) > 0 && startupCheck != "" {
+		runStartupGate(startupCheck, argv, originalEnv, snapshot)
+	}
+	if len(argv) > 0 {
+		executeCommand(argv, originalEnv)
+	}
+	metrics.push(true)
+}
+
+// loadEnvFiles loads custom environment files into the process environment.
+func loadEnvFiles(envFiles stringSlice) error {
+	log.Printf("Loading custom environment files: %s", envFiles.String())
+
+	processWins, err := parsePrecedence(os.Getenv("ENVWARP_PRECEDENCE"))
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_PRECEDENCE: %w", err)
+	}
+	processKeys := map[string]bool{}
+	if processWins {
+		for _, env := range os.Environ() {
+			key, _, _ := strings.Cut(env, "=")
+			processKeys[key] = true
+		}
+	}
+
+	streamSize, err := envStreamSize()
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_ENV_STREAM_SIZE: %w", err)
+	}
+
+	// Outer loop: process each file sequentially.
+	for _, file := range envFiles {
+		// Large, typically machine-generated files are streamed in one pass
+		if fi, err := os.Stat(file); err == nil && fi.Size() >= streamSize {
+			log.Printf("Streaming large env file: %s", file)
+			if err := streamEnvFile(file, processKeys); err != nil {
+				return fmt.Errorf("failed to load env file %s: %w", file, err)
+			}
+			continue
+		}
+
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read env file %s: %w", file, err)
+		}
+
+		// Required variables may be defined further down the same file, so
+		// they only fail if they are still missing once the file is stable.
+		var failures []string
+
+		// Inner loop: process each file multiple times to resolve nested variables within the same file.
+		for i := 0; i < 5; i++ { // Limit to 5 passes to prevent infinite loops.
+			changedCounter := 0
+
+			var text string
+			text, failures = expandRequired(string(raw), nil)
+			content, err := substituteVars(text)
+			if err != nil {
+				return fmt.Errorf("failed to substitute env file %s: %w", file, err)
+			}
+
+			envMap, err := godotenv.Unmarshal(content)
+			if err != nil {
+				return fmt.Errorf("failed to parse env file %s: %w", file, err)
+			}
+
+			for key, value := range envMap {
+				if processKeys[key] {
+					continue // The process environment takes precedence.
+				}
+				oldValue := os.Getenv(key)
+				if oldValue != value {
+					changedCounter++
+				}
+				if err := os.Setenv(key, value); err != nil {
+					return fmt.Errorf("failed to set env var %s from file %s: %w", key, file, err)
+				}
+				varSources[key] = "env file " + file
+			}
+
+			if changedCounter == 0 {
+				break // File is stable, move to the next file.
+			}
+		}
+
+		if len(failures) > 0 {
+			return fmt.Errorf("required variables missing in env file %s: %s", file, strings.Join(failures, "; "))
+		}
+	}
+	return nil
+}
+
+// parsePrecedence parses an ordered list of variable sources, lowest priority
+// first, and reports whether the process environment overrides env files.
+// An empty value keeps the default "process,files" order.
+func parsePrecedence(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	position := map[string]int{}
+	for i, source := range strings.Split(value, ",") {
+		source = strings.TrimSpace(source)
+		switch source {
+		case "process", "files":
+		default:
+			return false, fmt.Errorf("unsupported source %q", source)
+		}
+		if _, ok := position[source]; ok {
+			return false, fmt.Errorf("source %q listed more than once", source)
+		}
+		position[source] = i
+	}
+	if len(position) != 2 {
+		return false, fmt.Errorf("both \"process\" and \"files\" must be listed")
+	}
+	return position["process"] > position["files"], nil
+}
+
+// envEnabled reports whether the environment variable name is set to a true
+// value such as 1, true, yes or on.
+func envEnabled(name string) bool {
+	return enabledValue(os.Getenv(name))
+}
+
+// enabledValue reports whether a setting value is truthy.
+func enabledValue(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// setEnvFlag applies a flag value to its environment variable, letting the
+// flag take precedence when it is given.
+func setEnvFlag(key, value string) {
+	if value != "" {
+		os.Setenv(key, value)
+	}
+}
+
+// setTemplateFlag applies repeated --template flags to ENVWARP_TEMPLATE,
+// replacing its template sources when any are given.
+func setTemplateFlag(templates []string) {
+	setEnvFlag("ENVWARP_TEMPLATE", strings.Join(templates, string(os.PathListSeparator)))
+}
+
+// exportEnv sets an environment variable for envwarp and the executed command.
+// childEnv is the custom environment passed to executeCommand; a nil value
+// means the command inherits the process environment and is left as is.
+func exportEnv(childEnv []string, key, value string) []string {
+	if err := os.Setenv(key, value); err != nil {
+		log.Fatalf("Error setting env var %s: %v", key, err)
+	}
+	if childEnv == nil {
+		return nil
+	}
+	prefix := key + "="
+	for i, env := range childEnv {
+		if strings.HasPrefix(env, prefix) {
+			childEnv[i] = prefix + value
+			return childEnv
+		}
 	}
+	return append(childEnv, prefix+value)
 }
 
 // processSecrets iterates over environment variables and replaces secret references.
-func processSecrets() error {
+// If secretsDir is not empty, each resolved secret is also written to its own file there.
+func processSecrets(secretsDir string) error {
+	if secretsDir != "" {
+		if err := os.MkdirAll(secretsDir, 0700); err != nil {
+			return fmt.Errorf("failed to create secrets directory '%s': %w", secretsDir, err)
+		}
+		// Without detection, every directory would look like persistent storage
+		if tmpfsDetection && !isTmpfs(secretsDir) {
+			log.Printf("Warning: secrets directory %s is not on tmpfs, secrets will be persisted to disk", secretsDir)
+		}
+	}
+
 	for _, env := range os.Environ() {
 		parts := strings.SplitN(env, "=", 2)
 		if len(parts) != 2 {
@@ -165,113 +503,514 @@ func processSecrets() error {
 		if strings.HasPrefix(value, filePrefix) {
 			secretPath := strings.TrimPrefix(value, filePrefix)
 			if _, err := os.Stat(secretPath); err == nil {
-				file, err := os.Open(secretPath)
+				secretValue, ok, err := readSecretFile(secretPath)
 				if err != nil {
-					return fmt.Errorf("failed to open secret file %s: %w", secretPath, err)
+					return err
 				}
-				defer file.Close()
-
-				scanner := bufio.NewScanner(file)
-				if scanner.Scan() {
-					secretValue := scanner.Text()
-					if err := os.Setenv(name, secretValue); err != nil {
+				if ok {
+					if err := setSecret(name, secretValue); err != nil {
 						return fmt.Errorf("failed to set env var %s from secret file: %w", name, err)
 					}
+					varSources[name] = "secret file " + secretPath
+					secretRefs[name] = secretPath
 					log.Printf("Loaded secret for %s from %s", name, secretPath)
-				}
-				if err := scanner.Err(); err != nil {
-					return fmt.Errorf("failed to read secret file %s: %w", secretPath, err)
+					if secretsDir != "" {
+						if err := writeSecretFile(secretsDir, name, secretValue); err != nil {
+							return err
+						}
+					}
 				}
 			}
 		}
 	}
+	return checkUnresolvedReferences(os.Getenv("ENVWARP_UNRESOLVED"))
+}
+
+// readSecretFile returns the content of a secret file without its trailing
+// newline, and false if the file is empty. Only one newline is removed, so
+// multi-line secrets such as keys and certificates are kept intact.
+func readSecretFile(secretPath string) (string, bool, error) {
+	data, err := os.ReadFile(secretPath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read secret file %s: %w", secretPath, err)
+	}
+	if len(data) == 0 {
+		return "", false, nil
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), true, nil
+}
+
+// writeSecretFile writes a single secret value to a file named after its variable.
+func writeSecretFile(secretsDir, name, value string) error {
+	outPath := filepath.Join(secretsDir, name)
+	if err := writeFileAtomic(outPath, []byte(value), 0600); err != nil {
+		return err
+	}
+	log.Printf("Written secret for %s to %s", name, outPath)
 	return nil
 }
 
+// stdoutDir is the ENVWARP_CONFDIR value that prints rendered output to
+// stdout instead of writing files.
+const stdoutDir = "-"
+
 // processTemplates finds and processes all templates.
-func processTemplates(templatePath, confDir string) error {
+// It returns the paths of all written output files.
+func processTemplates(templatePath, confDir string) ([]string, error) {
 	// Ensure output directory exists
-	if err := os.MkdirAll(confDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory '%s': %w", confDir, err)
+	if confDir != stdoutDir {
+		if err := os.MkdirAll(confDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory '%s': %w", confDir, err)
+		}
 	}
 
-	fi, err := os.Stat(templatePath)
+	jobs, err := planTemplates(templatePath, confDir)
+	return writeJobs(jobs, err, confDir == stdoutDir)
+}
+
+// writeJobs renders the planned jobs and writes their outputs, or prints
+// them to stdout. Template errors found while planning, passed as planErr,
+// do not stop the remaining templates from being rendered, so everything is
+// reported in one pass.
+func writeJobs(jobs []renderJob, planErr error, toStdout bool) ([]string, error) {
+	failures, ok := planErr.(templateErrors)
+	if planErr != nil && !ok {
+		return nil, planErr
+	}
+
+	// Render everything before writing, so a failing template leaves the
+	// output untouched and all failures are reported at once.
+	contents, err := renderJobs(jobs)
+	defer removeStaged(jobs)
+	if rerr, ok := err.(templateErrors); ok {
+		failures = append(failures, rerr...)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		failures.sort()
+		return nil, failures
+	}
+	if err := checkPlaceholders(jobs, contents); err != nil {
+		return nil, err
+	}
+
+	if toStdout {
+		for i, content := range contents {
+			if err := writeStdout(jobs[i], content); err != nil {
+				return nil, fmt.Errorf("failed to write to stdout: %w", err)
+			}
+		}
+		return nil, nil
+	}
+
+	var outputs []string
+	for i, job := range jobs {
+		if err := writeOutput(job, contents[i]); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, job.output)
+	}
+	return outputs, nil
+}
+
+// writeStdout prints the rendered content of job, or its staged file.
+func writeStdout(job renderJob, content []byte) error {
+	if job.staged == "" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	f, err := os.Open(job.staged)
 	if err != nil {
-		return fmt.Errorf("cannot stat ENVWARP_TEMPLATE path '%s': %w", templatePath, err)
+		return err
 	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+// renderJob is a planned template render.
+type renderJob struct {
+	source string
+	output string
+	engine string
+	// directives enables #include and #if lines in envsubst templates.
+	directives bool
+	// escape is the envwarp-escape mode applied to substituted values.
+	escape string
+	body   []byte
+	info   fs.FileInfo
+	// offset is the number of header lines stripped before body.
+	offset int
+	// binary templates are copied through unchanged.
+	binary bool
+	// stream templates are too large to be held in memory; their body is
+	// left on disk from byte start on and rendered into the staged file.
+	stream bool
+	start  int64
+	staged string
+}
+
+// planTemplates collects the templates selected for rendering and their
+// output paths. ENVWARP_TEMPLATE may list several template sources, rendered
+// into the same confDir, with later sources overriding the outputs of earlier
+// ones. Per-template problems, such as two templates of one source writing the
+// same file, are returned as templateErrors alongside the valid jobs.
+func planTemplates(templatePath, confDir string) ([]renderJob, error) {
+	binaryMode, err := binaryTemplateMode()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := fsRetryPolicy(); err != nil {
+		return nil, err
+	}
+	if _, err := templateStreamSize(); err != nil {
+		return nil, err
+	}
+
+	exts := templateExtensions()
+	var jobs []renderJob
+	owners := map[string]templateOwner{}
+	var failures templateErrors
+	for set, templatePath := range templateSources(templatePath) {
+		root, files, err := findTemplates(templatePath, exts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			source := file.path
+			var job renderJob
+			fm := frontMatter{}
+			var terr *templateError
+			if file.static {
+				job, terr = loadStaticFile(source)
+			} else {
+				job, fm, terr = loadTemplate(source, binaryMode)
+			}
+			if terr != nil {
+				failures = append(failures, terr)
+				continue
+			}
+			if tags := fm.tags(); !shouldRender(tags, selectedTags()) {
+				log.Printf("Skipping template: %s (tags: %s)", source, strings.Join(tags, ", "))
+				continue
+			}
+
+			// Determine output path, mirroring the template's relative directory
+			// unless ENVWARP_FLATTEN is enabled
+			rel, err := filepath.Rel(root, source)
+			if err != nil {
+				return nil, err
+			}
+			if envEnabled("ENVWARP_FLATTEN") {
+				rel = filepath.Base(rel)
+			}
+			outFileName, _ := trimTemplateExt(filepath.Base(rel), exts)
+			outPath := filepath.Join(confDir, filepath.Dir(rel), outFileName)
+			if out := fm["out"]; out != "" {
+				if out, err = expandEnv(out); err != nil {
+					failures = append(failures, &templateError{file: source, err: fmt.Errorf("envwarp-out: %w", err)})
+					continue
+				}
+				if outPath, err = headerOutputPath(confDir, out); err != nil {
+					failures = append(failures, &templateError{file: source, err: fmt.Errorf("envwarp-out: %w", err)})
+					continue
+				}
+			}
 
+			job.output, job.engine, job.directives, job.escape = outPath, templateEngine(fm), fm.directives(), fm["escape"]
+			if err := checkEngine(job.engine, job.escape); err != nil {
+				failures = append(failures, &templateError{file: source, err: err})
+				continue
+			}
+			owner, ok := owners[outPath]
+			if ok && owner.set == set {
+				failures = append(failures, &templateError{file: source, err: fmt.Errorf("renders to %s, already rendered by %s", outPath, owner.source)})
+				continue
+			}
+			if ok {
+				log.Printf("Overriding template: %s with %s", owner.source, source)
+				jobs[owner.index] = job
+				owners[outPath] = templateOwner{source: source, set: set, index: owner.index}
+				continue
+			}
+			owners[outPath] = templateOwner{source: source, set: set, index: len(jobs)}
+			jobs = append(jobs, job)
+		}
+	}
+	if len(failures) > 0 {
+		return jobs, failures
+	}
+	return jobs, nil
+}
+
+// templateOwner is the template currently rendering an output path, from
+// the set-th template source.
+type templateOwner struct {
+	source string
+	set    int
+	index  int
+}
+
+// templateSources splits an ENVWARP_TEMPLATE value into its template
+// sources, separated by the OS path list separator (":" on Unix, ";" on
+// Windows) like PATH, so paths containing commas are kept whole.
+func templateSources(templatePath string) []string {
+	var sources []string
+	for _, field := range filepath.SplitList(templatePath) {
+		if field = strings.TrimSpace(field); field != "" {
+			sources = append(sources, field)
+		}
+	}
+	return sources
+}
+
+// findTemplates returns the templates of a single template source, either
+// a file or a directory, and the root their output paths are relative to.
+// With ENVWARP_COPY_STATIC, the other files of a directory are returned as
+// static files.
+func findTemplates(templatePath string, exts []string) (string, []templateFile, error) {
+	fi, err := os.Stat(templatePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot stat ENVWARP_TEMPLATE path '%s': %w", templatePath, err)
+	}
 	if !fi.IsDir() {
-		return processSingleFile(templatePath, confDir)
+		return filepath.Dir(templatePath), []templateFile{{path: templatePath}}, nil
 	}
 
-	return filepath.WalkDir(templatePath, func(path string, d fs.DirEntry, err error) error {
+	// WalkDir visits entries in lexical order, so templates are always
+	// planned, rendered and logged in the same order
+	var files []templateFile
+	static := copyStatic()
+	err = filepath.WalkDir(templatePath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".template") {
-			return processSingleFile(path, confDir)
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := trimTemplateExt(d.Name(), exts); ok {
+			files = append(files, templateFile{path: path})
+		} else if static && isRegularFile(path, d) {
+			files = append(files, templateFile{path: path, static: true})
 		}
 		return nil
 	})
+	if err != nil {
+		return "", nil, err
+	}
+	return templatePath, files, nil
 }
 
-// processSingleFile substitutes env vars into a single template file.
-func processSingleFile(filePath, confDir string) error {
-	log.Printf("Processing template: %s", filePath)
+// binaryTemplateMode returns how binary templates are handled, from
+// ENVWARP_BINARY: fail (default) or copy.
+func binaryTemplateMode() (string, error) {
+	mode := os.Getenv("ENVWARP_BINARY")
+	switch mode {
+	case "", "fail", "copy":
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid ENVWARP_BINARY value %q, must be one of fail, copy", mode)
+}
 
-	content, err := envsubst.ReadFile(filePath)
+// loadTemplate reads a template and its front matter into a job without an
+// output path or engine. Transient filesystem errors are retried.
+func loadTemplate(source, binaryMode string) (renderJob, frontMatter, *templateError) {
+	var info fs.FileInfo
+	err := retryFS(source, func() (err error) {
+		info, err = os.Stat(source)
+		return err
+	})
+	if err != nil {
+		return renderJob{}, nil, &templateError{file: source, err: fmt.Errorf("cannot stat template: %w", err)}
+	}
+	// Go templates are parsed whole, so only envsubst templates are streamed
+	if size, err := templateStreamSize(); err == nil && size > 0 && info.Size() >= size {
+		job, fm, terr := loadStreamTemplate(source, info, binaryMode)
+		if terr != nil || templateEngine(fm) != "gotemplate" {
+			return job, fm, terr
+		}
+	}
+	var raw []byte
+	err = retryFS(source, func() (err error) {
+		raw, err = os.ReadFile(source)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to substitute vars in %s: %w", filePath, err)
+		return renderJob{}, nil, &templateError{file: source, err: fmt.Errorf("failed to read: %w", err)}
+	}
+	return parseTemplate(source, raw, info, binaryMode)
+}
+
+// parseTemplate splits the raw content of a template into a job and its
+// front matter.
+func parseTemplate(source string, raw []byte, info fs.FileInfo, binaryMode string) (renderJob, frontMatter, *templateError) {
+	// Files with NUL bytes are binary and would be corrupted by
+	// substitution, so they are either copied unchanged or rejected
+	if bytes.IndexByte(raw, 0) != -1 {
+		if binaryMode != "copy" {
+			return renderJob{}, nil, &templateError{file: source, err: errors.New("template appears to be binary, set ENVWARP_BINARY=copy to copy it unchanged")}
+		}
+		return renderJob{source: source, body: raw, info: info, binary: true}, frontMatter{}, nil
 	}
+	fm, body := parseFrontMatter(raw)
+	offset := bytes.Count(raw[:len(raw)-len(body)], []byte("\n"))
+	return renderJob{source: source, body: body, info: info, offset: offset}, fm, nil
+}
 
-	// Determine output path
-	fileName := filepath.Base(filePath)
-	outFileName := strings.TrimSuffix(fileName, ".template")
-	outPath := filepath.Join(confDir, outFileName)
+// templateExtensions returns the template file extensions from
+// ENVWARP_TEMPLATE_EXT (comma-separated), defaulting to .template.
+func templateExtensions() []string {
+	exts := splitList(os.Getenv("ENVWARP_TEMPLATE_EXT"))
+	if len(exts) == 0 {
+		return []string{".template"}
+	}
+	for i, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			exts[i] = "." + ext
+		}
+	}
+	// Match the longest extension first, so .conf.tpl wins over .tpl.
+	sort.Slice(exts, func(i, j int) bool { return len(exts[i]) > len(exts[j]) })
+	return exts
+}
 
-	if err := os.WriteFile(outPath, content, 0644); err != nil {
-		return fmt.Errorf("failed to write to %s: %w", outPath, err)
+// trimTemplateExt strips the first matching template extension from name.
+// It reports false, returning name unchanged, if none matches.
+func trimTemplateExt(name string, exts []string) (string, bool) {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return name, false
+}
+
+// writeOutput writes a rendered template to its output path with the
+// template's permissions, and its ownership too when ENVWARP_PRESERVE_OWNER
+// is enabled. A file that already has the rendered content is left alone, so
+// its mtime does not change. Transient filesystem errors are retried.
+func writeOutput(job renderJob, content []byte) error {
+	err := retryFS(job.output, func() error {
+		return os.MkdirAll(filepath.Dir(job.output), 0755)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", job.output, err)
+	}
+
+	perm := job.info.Mode().Perm()
+	var unchanged bool
+	if job.staged != "" {
+		unchanged = filesEqual(job.output, job.staged)
+	} else {
+		existing, err := os.ReadFile(job.output)
+		unchanged = err == nil && bytes.Equal(existing, content)
+	}
+	if unchanged {
+		if fi, err := os.Stat(job.output); err == nil && fi.Mode().Perm() != perm {
+			if err := os.Chmod(job.output, perm); err != nil {
+				return fmt.Errorf("failed to set permissions on %s: %w", job.output, err)
+			}
+		}
+	} else if err := retryFS(job.output, func() error { return writeJobFile(job, content, perm) }); err != nil {
+		return err
 	}
+	if envEnabled("ENVWARP_PRESERVE_OWNER") {
+		if err := copyOwner(job.info, job.output); err != nil {
+			return err
+		}
+	}
+
+	recordRendered(job)
 
-	log.Printf("Successfully written to: %s", outPath)
+	if unchanged {
+		log.Printf("Unchanged: %s", job.output)
+	} else {
+		log.Printf("Successfully written to: %s", job.output)
+	}
 	return nil
 }
 
-// executeCommand replaces the current process with the specified command.
-func executeCommand(command string, customEnv []string) {
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		log.Fatal("Error: ENVWARP_EXECUTION is empty.")
+// writeJobFile atomically writes the rendered content of job, or copies its
+// staged file, to the output path.
+func writeJobFile(job renderJob, content []byte, perm os.FileMode) error {
+	if job.staged == "" {
+		return writeFileAtomic(job.output, content, perm)
 	}
-	cmdPath, err := exec.LookPath(parts[0])
+	f, err := os.Open(job.staged)
 	if err != nil {
-		log.Fatalf("Error: Command not found in PATH: %s", parts[0])
+		return err
 	}
+	defer f.Close()
+	return copyFileAtomic(job.output, f, perm)
+}
 
-	log.Printf("Executing command: %s", command)
+// executeCommand replaces the current process with the specified command.
+func executeCommand(argv []string, customEnv []string) {
+	cmdPath, argv, err := lookupCommand(argv)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-	// If customEnv is nil, it means we used the default environment.
-	// syscall.Exec will inherit it automatically.
-	// If customEnv is not nil, we must pass it explicitly.
-	env := os.Environ()
-	if customEnv != nil {
-		env = customEnv
+	log.Printf("Executing command: %s", strings.Join(argv, " "))
+	emitEvent(execEvent(argv))
+
+	if err := applyProcessGroup(); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
-	if err := syscall.Exec(cmdPath, parts, env); err != nil {
+	// Hardening is per thread, so exec must happen on the same thread.
+	runtime.LockOSThread()
+	if err := applyHardening(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if err := syscall.Exec(cmdPath, argv, childEnvironment(customEnv)); err != nil {
 		log.Fatalf("Error: Failed to execute command: %v", err)
 	}
 }
 
-// runHealthCheck executes a health check and exits based on the result.
+// failRender reports a failed render to the metrics and event endpoints and
+// exits with the error.
+func failRender(metrics *runMetrics, format string, err error) {
+	metrics.push(false)
+	emitEvent(lifecycleEvent{Event: "render-failure", Duration: time.Since(metrics.start).Seconds(), Error: err.Error()})
+	fatalf(format, err)
+}
+
+// childEnvironment returns the environment for commands started by envwarp.
+// If customEnv is nil, it means we used the default environment and the
+// child inherits it. If customEnv is not nil, it is passed explicitly.
+func childEnvironment(customEnv []string) []string {
+	if customEnv != nil {
+		return customEnv
+	}
+	return os.Environ()
+}
+
+// runHealthCheck executes a health check, reports its result and exits
+// based on it.
 func runHealthCheck(address string) {
-	const timeout = 5 * time.Second
 	log.Printf("Starting health check for: %s", address)
+	start := time.Now()
+	healthy := checkHealth(address)
+	reportCheckResult(address, healthy, time.Since(start))
+	if !healthy {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// checkHealth checks address and logs the outcome.
+func checkHealth(address string) bool {
+	const timeout = 5 * time.Second
 
 	switch {
 	case strings.HasPrefix(address, "https://"):
 		log.Printf("Error: HTTPS health checks are not supported in this build to reduce binary size.")
-		os.Exit(1)
+		return false
 
 	case strings.HasPrefix(address, "http://"):
 		target := strings.TrimPrefix(address, "http://")
@@ -281,10 +1020,11 @@ func runHealthCheck(address string) {
 			path = target[idx:]
 		}
 
-		conn, err := net.DialTimeout("tcp", host, timeout)
+		// The port defaults to 80 as in any http:// URL
+		conn, err := dialTCP(withDefaultPort(host, "80"), timeout)
 		if err != nil {
 			log.Printf("HTTP check failed: %v", err)
-			os.Exit(1)
+			return false
 		}
 		defer conn.Close()
 
@@ -293,35 +1033,43 @@ func runHealthCheck(address string) {
 		req := fmt.Sprintf("HEAD %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", path, host)
 		if _, err := conn.Write([]byte(req)); err != nil {
 			log.Printf("HTTP check failed on write: %v", err)
-			os.Exit(1)
+			return false
 		}
 
 		reader := bufio.NewReader(conn)
 		statusLine, err := reader.ReadString('\n')
 		if err != nil {
 			log.Printf("HTTP check failed on read: %v", err)
-			os.Exit(1)
+			return false
 		}
 
 		parts := strings.SplitN(strings.TrimSpace(statusLine), " ", 3)
 		if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") {
 			log.Printf("HTTP check failed, invalid status line: %q", statusLine)
-			os.Exit(1)
+			return false
 		}
 
 		code, err := strconv.Atoi(parts[1])
 		if err != nil {
 			log.Printf("HTTP check failed, invalid status code: %q", parts[1])
-			os.Exit(1)
+			return false
 		}
 
-		if code < 500 {
-			log.Printf("HTTP check successful, service is online. Status code: %d", code)
-			os.Exit(0)
-		} else {
+		if code >= 500 {
 			log.Printf("HTTP check failed, server error. Status code: %d", code)
-			os.Exit(1)
+			return false
+		}
+		log.Printf("HTTP check successful, service is online. Status code: %d", code)
+		return true
+
+	case strings.HasPrefix(address, "rendered://"):
+		n, err := checkRendered(strings.TrimPrefix(address, "rendered://"))
+		if err != nil {
+			log.Printf("Rendered config check failed: %v", err)
+			return false
 		}
+		log.Printf("Rendered config check successful, %d file(s) up to date.", n)
+		return true
 
 	case strings.HasPrefix(address, "unix://"), strings.HasPrefix(address, "unix/"):
 		socketPath := strings.TrimPrefix(address, "unix://")
@@ -330,14 +1078,14 @@ func runHealthCheck(address string) {
 		conn, err := net.DialTimeout("unix", socketPath, timeout)
 		if err != nil {
 			log.Printf("UNIX socket check failed: %v", err)
-			os.Exit(1)
+			return false
 		}
 		conn.Close()
 		log.Println("UNIX socket check successful.")
-		os.Exit(0)
+		return true
 
 	default:
 		log.Printf("Error: Unsupported address format for check: %s", address)
-		os.Exit(1)
+		return false
 	}
 }
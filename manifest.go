@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestName is the file name of the render manifest in ENVWARP_CONFDIR.
+const manifestName = ".envwarp-manifest.json"
+
+// renderManifest records the files written by a run, so health checks can
+// tell that envwarp actually produced the config.
+type renderManifest struct {
+	Rendered time.Time       `json:"rendered"`
+	Files    []manifestEntry `json:"files"`
+}
+
+// manifestEntry is an output file and the template it was rendered from.
+type manifestEntry struct {
+	Output   string `json:"output"`
+	Template string `json:"template"`
+	Size     int64  `json:"size"`
+}
+
+// renderedFiles holds the entries of the files written so far, keyed by
+// output path. Outputs are written one at a time, so it needs no locking.
+var renderedFiles = map[string]manifestEntry{}
+
+// manifestPath returns where the render manifest is kept: ENVWARP_MANIFEST,
+// or .envwarp-manifest.json in ENVWARP_CONFDIR. It is empty if there is
+// neither.
+func manifestPath() string {
+	if path := os.Getenv("ENVWARP_MANIFEST"); path != "" {
+		return path
+	}
+	if confDir := os.Getenv("ENVWARP_CONFDIR"); confDir != "" && confDir != stdoutDir {
+		return filepath.Join(confDir, manifestName)
+	}
+	return ""
+}
+
+// recordRendered adds a written output to the manifest entries.
+func recordRendered(job renderJob) {
+	output, err := filepath.Abs(job.output)
+	if err != nil {
+		output = job.output
+	}
+	source, err := filepath.Abs(job.source)
+	if err != nil {
+		source = job.source
+	}
+	entry := manifestEntry{Output: output, Template: source}
+	if fi, err := os.Stat(job.output); err == nil {
+		entry.Size = fi.Size()
+	}
+	renderedFiles[job.output] = entry
+}
+
+// writeManifest writes the manifest of outputs, in the order they were
+// rendered in, to the manifest path.
+func writeManifest(outputs []string) error {
+	path := manifestPath()
+	if path == "" {
+		return nil
+	}
+	manifest := renderManifest{Rendered: time.Now().UTC(), Files: []manifestEntry{}}
+	for _, output := range outputs {
+		if entry, ok := renderedFiles[output]; ok {
+			manifest.Files = append(manifest.Files, entry)
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// checkRendered verifies the outputs listed in the manifest at path, a
+// manifest file or a directory containing one: every output must exist, must
+// not be empty unless it was rendered empty, and its template must not have
+// changed since the render. It returns the number of files checked.
+func checkRendered(path string) (int, error) {
+	if path == "" {
+		path = manifestPath()
+	}
+	if path == "" {
+		return 0, errors.New("no manifest to check, set ENVWARP_CONFDIR or ENVWARP_MANIFEST")
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, manifestName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest renderManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return 0, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	failed := 0
+	for _, entry := range manifest.Files {
+		fi, err := os.Stat(entry.Output)
+		switch {
+		case err != nil:
+			log.Printf("Missing output: %s", entry.Output)
+		case fi.Size() == 0 && entry.Size > 0:
+			log.Printf("Empty output: %s", entry.Output)
+		default:
+			// A removed template cannot be newer than its output
+			tfi, err := os.Stat(entry.Template)
+			if err != nil || !tfi.ModTime().After(manifest.Rendered) {
+				continue
+			}
+			log.Printf("Stale output: %s (%s changed since the render at %s)", entry.Output, entry.Template, manifest.Rendered.Format(time.RFC3339))
+		}
+		failed++
+	}
+	if failed > 0 {
+		return len(manifest.Files), fmt.Errorf("%d of %d rendered file(s) missing, empty or stale", failed, len(manifest.Files))
+	}
+	return len(manifest.Files), nil
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// createMemfd stores data in an anonymous memory file that is inherited
+// across exec and returns the path the child can read it from.
+func createMemfd(name string, data []byte) (string, error) {
+	// No MFD_CLOEXEC: the descriptor must survive exec.
+	fd, err := unix.MemfdCreate(name, 0)
+	if err != nil {
+		return "", fmt.Errorf("memfd_create: %w", err)
+	}
+	for len(data) > 0 {
+		n, err := unix.Write(fd, data)
+		if err != nil {
+			unix.Close(fd)
+			return "", fmt.Errorf("failed to write memfd: %w", err)
+		}
+		data = data[n:]
+	}
+	return fmt.Sprintf("/proc/self/fd/%d", fd), nil
+}
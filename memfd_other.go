@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// createMemfd is only supported on Linux.
+func createMemfd(name string, data []byte) (string, error) {
+	return "", errors.New("memfd secrets are only supported on linux")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMetricsJob = "envwarp"
+	metricsTimeout    = 5 * time.Second
+)
+
+// runMetrics tracks a run for the metrics pushed when envwarp exits instead
+// of handing over to a resident command, so one-shot and init jobs are
+// observable too.
+type runMetrics struct {
+	start    time.Time
+	duration time.Duration
+	files    int
+}
+
+// startMetrics starts tracking a run.
+func startMetrics() *runMetrics {
+	return &runMetrics{start: time.Now()}
+}
+
+// rendered records the end of rendering and the number of files written.
+func (m *runMetrics) rendered(outputs []string) {
+	m.duration = time.Since(m.start)
+	m.files = len(outputs)
+}
+
+// push sends the metrics of the run to the Prometheus pushgateway at
+// ENVWARP_METRICS_PUSHGATEWAY and the statsd server at ENVWARP_METRICS_STATSD,
+// if set. Failures are only logged, so an unreachable endpoint never fails
+// the run.
+func (m *runMetrics) push(success bool) {
+	if m.duration == 0 {
+		m.duration = time.Since(m.start)
+	}
+	job := os.Getenv("ENVWARP_METRICS_JOB")
+	if job == "" {
+		job = defaultMetricsJob
+	}
+	if gateway := os.Getenv("ENVWARP_METRICS_PUSHGATEWAY"); gateway != "" {
+		if err := m.pushGateway(gateway, job, success); err != nil {
+			log.Printf("Warning: Failed to push metrics to %s: %v", gateway, err)
+		}
+	}
+	if statsd := os.Getenv("ENVWARP_METRICS_STATSD"); statsd != "" {
+		if err := m.sendStatsd(statsd, job, success); err != nil {
+			log.Printf("Warning: Failed to send metrics to %s: %v", statsd, err)
+		}
+	}
+}
+
+// pushGateway replaces the metrics of job on a Prometheus pushgateway.
+func (m *runMetrics) pushGateway(gateway, job string, success bool) error {
+	var b strings.Builder
+	for _, metric := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"envwarp_render_duration_seconds", "Time taken to render the configuration.", m.duration.Seconds()},
+		{"envwarp_run_success", "Whether the run succeeded (1) or failed (0).", boolValue(success)},
+		{"envwarp_rendered_files", "Number of files written.", float64(m.files)},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", metric.name, metric.help, metric.name, metric.name, metric.value)
+	}
+
+	address := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	code, err := httpRequest("PUT", address, "text/plain; version=0.0.4", []byte(b.String()), metricsTimeout)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("unexpected status code %d", code)
+	}
+	return nil
+}
+
+// sendStatsd sends the metrics of the run to a statsd server over UDP,
+// prefixed with job.
+func (m *runMetrics) sendStatsd(address, job string, success bool) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return errors.New("must be host:port")
+	}
+	conn, err := net.DialTimeout("udp", address, metricsTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	payload := fmt.Sprintf("%s.render.duration:%d|ms\n%s.run.success:%g|g\n%s.render.files:%d|g",
+		job, m.duration.Milliseconds(), job, boolValue(success), job, m.files)
+	_, err = conn.Write([]byte(payload))
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	hostsPath      = "/etc/hosts"
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+// setupNetworkFiles appends ENVWARP_HOSTS entries to /etc/hosts and applies
+// ENVWARP_RESOLV_NDOTS/ENVWARP_RESOLV_SEARCH to /etc/resolv.conf.
+// Both files are usually bind-mounted by the runtime, so they are rewritten in place.
+func setupNetworkFiles() error {
+	if err := appendHosts(os.Getenv("ENVWARP_HOSTS")); err != nil {
+		return err
+	}
+	return patchResolvConf(os.Getenv("ENVWARP_RESOLV_NDOTS"), os.Getenv("ENVWARP_RESOLV_SEARCH"))
+}
+
+// appendHosts appends comma-separated "ip name..." entries that are not yet present.
+func appendHosts(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	content, err := os.ReadFile(hostsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", hostsPath, err)
+	}
+
+	existing := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		existing[strings.Join(strings.Fields(line), " ")] = true
+	}
+
+	var added []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.Join(strings.Fields(entry), " ")
+		if entry == "" || existing[entry] {
+			continue
+		}
+		if len(strings.Fields(entry)) < 2 {
+			return fmt.Errorf("invalid ENVWARP_HOSTS entry %q, expected \"ip name...\"", entry)
+		}
+		added = append(added, entry)
+		existing[entry] = true
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	out := string(content)
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	out += strings.Join(added, "\n") + "\n"
+	if err := os.WriteFile(hostsPath, []byte(out), 0644); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", hostsPath, err)
+	}
+	log.Printf("Added %d entries to %s", len(added), hostsPath)
+	return nil
+}
+
+// patchResolvConf sets the ndots option and/or replaces the search list.
+func patchResolvConf(ndots, search string) error {
+	if ndots == "" && search == "" {
+		return nil
+	}
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", resolvConfPath, err)
+	}
+
+	var lines []string
+	ndotsDone := ndots == ""
+	searchDone := search == ""
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 0 && (fields[0] == "search" || fields[0] == "domain") && search != "":
+			// search and domain are mutually exclusive, the last one wins.
+			if searchDone {
+				continue
+			}
+			line = "search " + search
+			searchDone = true
+		case len(fields) > 0 && fields[0] == "options" && ndots != "":
+			opts := []string{"options"}
+			for _, opt := range fields[1:] {
+				if !strings.HasPrefix(opt, "ndots:") {
+					opts = append(opts, opt)
+				}
+			}
+			if !ndotsDone {
+				opts = append(opts, "ndots:"+ndots)
+				ndotsDone = true
+			}
+			if len(opts) == 1 {
+				continue
+			}
+			line = strings.Join(opts, " ")
+		}
+		if line != "" || len(lines) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if !searchDone {
+		lines = append(lines, "search "+search)
+	}
+	if !ndotsDone {
+		lines = append(lines, "options ndots:"+ndots)
+	}
+
+	if err := os.WriteFile(resolvConfPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", resolvConfPath, err)
+	}
+	log.Printf("Updated %s", resolvConfPath)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// runOneshot runs argv to completion unless the marker file records a
+// previous successful run for the same command and rendered configuration.
+// On success, the marker is updated. It pushes the run's metrics and exits
+// with the command's exit code.
+func runOneshot(marker string, argv []string, customEnv []string, outputs []string, metrics *runMetrics) {
+	if len(argv) == 0 {
+		log.Fatal("Error: ENVWARP_EXECUTION must be set when ENVWARP_ONESHOT_MARKER is used.")
+	}
+
+	hash, err := renderedHash(argv, outputs)
+	if err != nil {
+		log.Fatalf("Error: Failed to hash rendered configuration: %v", err)
+	}
+
+	if previous, err := os.ReadFile(marker); err == nil && string(bytes.TrimSpace(previous)) == hash {
+		log.Printf("Marker %s matches the current configuration, skipping execution", marker)
+		metrics.push(true)
+		os.Exit(0)
+	}
+
+	grace, err := stopGracePeriod()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	emitEvent(execEvent(argv))
+	child, err := startChild(argv, customEnv)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	code := waitChild(child, grace)
+	if code != 0 {
+		metrics.push(false)
+		os.Exit(code)
+	}
+
+	if err := os.WriteFile(marker, []byte(hash+"\n"), 0644); err != nil {
+		metrics.push(false)
+		log.Fatalf("Error: Failed to write success marker %s: %v", marker, err)
+	}
+	log.Printf("Recorded success in marker: %s", marker)
+	metrics.push(true)
+	os.Exit(0)
+}
+
+// renderedHash returns a sha256 over the command and all rendered outputs.
+func renderedHash(argv []string, outputs []string) (string, error) {
+	sorted := append([]string(nil), outputs...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, arg := range argv {
+		fmt.Fprintf(h, "%s\x00", arg)
+	}
+	for _, path := range sorted {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", path, len(content))
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
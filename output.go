@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// absoluteOutputBase, when set, is the directory absolute envwarp-out paths
+// are written below instead of the filesystem root, so dry runs and drift
+// detection never touch live files.
+var absoluteOutputBase string
+
+// headerOutputPath resolves an envwarp-out header: relative paths are
+// relative to confDir and must not escape it, absolute paths are used as
+// they are.
+func headerOutputPath(confDir, out string) (string, error) {
+	if !filepath.IsAbs(out) {
+		path := filepath.Join(confDir, out)
+		if rel, err := filepath.Rel(confDir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("relative path %q is outside ENVWARP_CONFDIR, use an absolute path to write there", out)
+		}
+		return path, nil
+	}
+	if absoluteOutputBase != "" {
+		return filepath.Join(absoluteOutputBase, out), nil
+	}
+	return filepath.Clean(out), nil
+}
+
+// livePath maps a file rendered below absoluteOutputBase back to the
+// absolute path it would be written to.
+func livePath(rel string) string {
+	path := filepath.FromSlash(rel)
+	if !filepath.IsAbs(path) {
+		path = string(filepath.Separator) + path
+	}
+	return path
+}
+
+// compareAbsolute compares the files rendered below base with the live
+// files at their absolute paths. Paths in the report are absolute.
+func compareAbsolute(base string) (*driftReport, error) {
+	report := &driftReport{Changed: []string{}, Missing: []string{}, Extra: []string{}}
+	want, err := listFiles(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return nil, err
+	}
+	for rel := range want {
+		path := livePath(rel)
+		liveContent, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, filepath.ToSlash(path))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		wantContent, err := os.ReadFile(filepath.Join(base, rel))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(wantContent, liveContent) {
+			report.Changed = append(report.Changed, filepath.ToSlash(path))
+		}
+	}
+	sort.Strings(report.Changed)
+	sort.Strings(report.Missing)
+	return report, nil
+}
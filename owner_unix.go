@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// copyOwner gives path the uid and gid of the source file. It is a no-op
+// unless envwarp runs as root.
+func copyOwner(src fs.FileInfo, path string) error {
+	st, ok := src.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	if err := os.Lchown(path, int(st.Uid), int(st.Gid)); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package main
+
+import "io/fs"
+
+// copyOwner is a no-op on Windows, which has no uid/gid ownership.
+func copyOwner(src fs.FileInfo, path string) error {
+	return nil
+}
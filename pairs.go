@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// templatePair is a template rendered to an explicit destination via -t.
+type templatePair struct {
+	source string
+	dest   string
+}
+
+// parseTemplatePairs parses -t values of the form SRC:DEST. They are split
+// on the last colon that is not part of a drive letter, so SRC may contain
+// colons and Windows paths like C:\tpl\a:C:\out\a work.
+func parseTemplatePairs(values []string) ([]templatePair, error) {
+	pairs := make([]templatePair, 0, len(values))
+	for _, value := range values {
+		source, dest, ok := cutPair(value)
+		if !ok || source == "" || dest == "" {
+			return nil, fmt.Errorf("invalid -t value %q, must be SRC:DEST", value)
+		}
+		pairs = append(pairs, templatePair{source: source, dest: dest})
+	}
+	return pairs, nil
+}
+
+// cutPair splits value around its last colon that does not follow a drive
+// letter at the start of SRC or DEST.
+func cutPair(value string) (string, string, bool) {
+	for i := strings.LastIndex(value, ":"); i >= 0; i = strings.LastIndex(value[:i], ":") {
+		drive := i >= 1 && len(filepath.VolumeName(value[i-1:])) == 2 && (i == 1 || value[i-2] == ':')
+		if !drive {
+			return value[:i], value[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// processPairs renders each template to its destination, creating parent
+// directories as needed.
+func processPairs(pairs []templatePair) ([]string, error) {
+	jobs, err := planPairs(pairs)
+	return writeJobs(jobs, err, false)
+}
+
+// planPairs loads the templates of pairs. Tags and envwarp-out headers do
+// not apply, since the destination is given explicitly.
+func planPairs(pairs []templatePair) ([]renderJob, error) {
+	binaryMode, err := binaryTemplateMode()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := fsRetryPolicy(); err != nil {
+		return nil, err
+	}
+
+	var jobs []renderJob
+	owners := map[string]string{}
+	var failures templateErrors
+	for _, pair := range pairs {
+		job, fm, terr := loadTemplate(pair.source, binaryMode)
+		if terr != nil {
+			failures = append(failures, terr)
+			continue
+		}
+		dest := filepath.Clean(pair.dest)
+		if owner, ok := owners[dest]; ok {
+			failures = append(failures, &templateError{file: pair.source, err: fmt.Errorf("renders to %s, already rendered by %s", dest, owner)})
+			continue
+		}
+		owners[dest] = pair.source
+		job.output, job.engine, job.directives, job.escape = dest, templateEngine(fm), fm.directives(), fm["escape"]
+		if err := checkEngine(job.engine, job.escape); err != nil {
+			failures = append(failures, &templateError{file: pair.source, err: err})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(failures) > 0 {
+		return jobs, failures
+	}
+	return jobs, nil
+}
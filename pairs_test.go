@@ -0,0 +1,44 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestParseTemplatePairs(t *testing.T) {
+	tests := []struct {
+		value        string
+		source, dest string
+		wantErr      bool
+		windows      bool
+	}{
+		{value: "app.conf.tmpl:/etc/app/app.conf", source: "app.conf.tmpl", dest: "/etc/app/app.conf"},
+		{value: "a:b", source: "a", dest: "b"},
+		{value: "tpl/a:b.tmpl:/etc/ab", source: "tpl/a:b.tmpl", dest: "/etc/ab"},
+		{value: `C:\tpl\a:C:\out\a`, source: `C:\tpl\a`, dest: `C:\out\a`, windows: true},
+		{value: `tpl\a:D:\out\a`, source: `tpl\a`, dest: `D:\out\a`, windows: true},
+		{value: `C:\tpl\a:out\a`, source: `C:\tpl\a`, dest: `out\a`, windows: true},
+		{value: "app.conf", wantErr: true},
+		{value: ":/etc/app.conf", wantErr: true},
+		{value: "app.conf:", wantErr: true},
+	}
+	for _, tt := range tests {
+		if tt.windows && runtime.GOOS != "windows" {
+			continue
+		}
+		pairs, err := parseTemplatePairs([]string{tt.value})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTemplatePairs(%q) = %v, want error", tt.value, pairs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTemplatePairs(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if pairs[0].source != tt.source || pairs[0].dest != tt.dest {
+			t.Errorf("parseTemplatePairs(%q) = %q:%q, want %q:%q", tt.value, pairs[0].source, pairs[0].dest, tt.source, tt.dest)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// plainReference matches `$$` escapes and the ${VAR} and $VAR references
+// without a default or any other operator.
+var plainReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// passthroughMode reports whether ENVWARP_PASSTHROUGH (or --passthrough) is
+// enabled.
+func passthroughMode() bool {
+	return envEnabled("ENVWARP_PASSTHROUGH")
+}
+
+// setPassthroughFlag applies a --passthrough flag, which enables
+// ENVWARP_PASSTHROUGH.
+func setPassthroughFlag(passthrough bool) {
+	if passthrough {
+		os.Setenv("ENVWARP_PASSTHROUGH", "true")
+	}
+}
+
+// keepUnsetReferences escapes the plain references to unset variables in
+// text, so envsubst leaves them in the output as they are, for a later stage
+// to fill in. Variables that are set, even to an empty string, are still
+// substituted.
+func keepUnsetReferences(text string) string {
+	return plainReference.ReplaceAllStringFunc(text, func(match string) string {
+		if match == "$$" {
+			return match
+		}
+		name := strings.Trim(match, "${}")
+		if _, ok := privateSecrets[name]; ok {
+			return match
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			return match
+		}
+		return "$" + match
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPatchPrefix = "PATCH_"
+	// sectionSeparator separates the section from the key in override variable names.
+	sectionSeparator = "__"
+)
+
+// patchOverride is a single key=value override within an optional section.
+type patchOverride struct {
+	section string
+	key     string
+	value   string
+}
+
+// processPatch applies overrides from the environment to ENVWARP_PATCH_FILE in place.
+func processPatch() error {
+	target := os.Getenv("ENVWARP_PATCH_FILE")
+	if target == "" {
+		return nil
+	}
+
+	format := os.Getenv("ENVWARP_PATCH_FORMAT")
+	if format == "" {
+		format = patchFormatFromExt(target)
+	}
+
+	prefix := os.Getenv("ENVWARP_PATCH_PREFIX")
+	if prefix == "" {
+		prefix = defaultPatchPrefix
+	}
+
+	log.Printf("Patching %s (%s)", target, format)
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("cannot stat ENVWARP_PATCH_FILE '%s': %w", target, err)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", target, err)
+	}
+
+	var patched []byte
+	switch format {
+	case "ini", "toml", "properties":
+		overrides := collectOverrides(prefix, format != "properties")
+		if len(overrides) == 0 {
+			log.Printf("No variables with prefix %s found, nothing to patch", prefix)
+			return nil
+		}
+		patched = patchKeyValue(content, overrides, format)
+	case "json", "yaml":
+		if patched, err = patchDocument(content, format); err != nil {
+			return err
+		}
+	case "xml":
+		if patched, err = patchXML(content); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported patch format %q", format)
+	}
+
+	// Written atomically, the file is never seen half patched.
+	if err := writeFileAtomic(target, patched, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully patched: %s", target)
+	return nil
+}
+
+// patchFormatFromExt guesses the patch format from the file extension.
+func patchFormatFromExt(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return "toml"
+	case ".properties":
+		return "properties"
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".xml":
+		return "xml"
+	default:
+		return "ini"
+	}
+}
+
+// collectOverrides builds overrides from variables named <prefix>[<section>__]<key>.
+// The result is sorted to keep the output deterministic.
+func collectOverrides(prefix string, withSections bool) []patchOverride {
+	var overrides []patchOverride
+	for _, env := range renderEnviron() {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		o := patchOverride{key: strings.TrimPrefix(name, prefix), value: value}
+		if withSections {
+			if section, key, found := strings.Cut(o.key, sectionSeparator); found {
+				o.section, o.key = section, key
+			}
+		}
+		if o.key == "" {
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].section != overrides[j].section {
+			return overrides[i].section < overrides[j].section
+		}
+		return overrides[i].key < overrides[j].key
+	})
+	return overrides
+}
+
+// patchKeyValue applies overrides to INI, TOML or .properties content line by
+// line, so comments, ordering and unknown keys are preserved. Missing keys are
+// appended to their section, missing sections to the end of the file.
+func patchKeyValue(content []byte, overrides []patchOverride, format string) []byte {
+	text := string(content)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+
+	pending := map[patchOverride]bool{}
+	for _, o := range overrides {
+		pending[o] = true
+	}
+
+	// lastLine records the index of the last line belonging to each section,
+	// used to append missing keys at the right place.
+	lastLine := map[string]int{"": -1}
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if format != "properties" && strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			if strings.HasPrefix(trimmed, "[[") {
+				// Arrays of tables cannot be addressed by name.
+				section = trimmed
+			}
+			lastLine[section] = i
+			continue
+		}
+		if trimmed == "" || isPatchComment(trimmed, format) {
+			continue
+		}
+
+		sepIdx := strings.IndexAny(line, "=:")
+		if format != "properties" {
+			sepIdx = strings.Index(line, "=")
+		}
+		if sepIdx == -1 {
+			continue
+		}
+		key := strings.TrimSpace(line[:sepIdx])
+		lastLine[section] = i
+		for _, o := range overrides {
+			if !pending[o] || o.section != section || o.key != key {
+				continue
+			}
+			// Keep the original key and separator formatting.
+			lead := line[:sepIdx+1]
+			rest := line[sepIdx+1:]
+			if len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
+				lead += rest[:1]
+			}
+			lines[i] = lead + formatPatchValue(o.value, format)
+			delete(pending, o)
+		}
+	}
+
+	// Insert missing keys into existing sections, from the bottom up so the
+	// recorded line indexes stay valid.
+	inserts := map[int][]string{}
+	var newSections []string
+	newSectionLines := map[string][]string{}
+	for _, o := range overrides {
+		if !pending[o] {
+			continue
+		}
+		entry := o.key + " = " + formatPatchValue(o.value, format)
+		if format == "properties" {
+			entry = o.key + "=" + o.value
+		}
+		if idx, ok := lastLine[o.section]; ok {
+			inserts[idx] = append(inserts[idx], entry)
+			continue
+		}
+		if _, ok := newSectionLines[o.section]; !ok {
+			newSections = append(newSections, o.section)
+		}
+		newSectionLines[o.section] = append(newSectionLines[o.section], entry)
+	}
+
+	var out []string
+	out = append(out, inserts[-1]...)
+	for i, line := range lines {
+		out = append(out, line)
+		out = append(out, inserts[i]...)
+	}
+	for _, name := range newSections {
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, "["+name+"]")
+		out = append(out, newSectionLines[name]...)
+	}
+
+	result := strings.Join(out, "\n")
+	if trailingNewline || text == "" {
+		result += "\n"
+	}
+	return []byte(result)
+}
+
+// isPatchComment reports whether a trimmed line is a comment in the given format.
+func isPatchComment(trimmed, format string) bool {
+	switch format {
+	case "properties":
+		return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "!")
+	case "toml":
+		return strings.HasPrefix(trimmed, "#")
+	default:
+		return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+	}
+}
+
+// formatPatchValue quotes TOML values that are not already valid literals.
+// INI and .properties values are written verbatim.
+func formatPatchValue(value, format string) string {
+	if format != "toml" {
+		return value
+	}
+	switch {
+	case value == "true", value == "false":
+		return value
+	case strings.HasPrefix(value, `"`), strings.HasPrefix(value, "'"),
+		strings.HasPrefix(value, "["), strings.HasPrefix(value, "{"):
+		return value
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil {
+		return value
+	}
+	return strconv.Quote(value)
+}
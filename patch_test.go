@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+func TestPatchKeyValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		content   string
+		overrides []patchOverride
+		want      string
+	}{
+		{
+			name:      "ini keeps formatting",
+			format:    "ini",
+			content:   "; settings\n[server]\nport=80\nhost = old # keep\n\n[log]\nlevel = info\n",
+			overrides: []patchOverride{{section: "server", key: "port", value: "8080"}, {section: "log", key: "level", value: "debug"}},
+			want:      "; settings\n[server]\nport=8080\nhost = old # keep\n\n[log]\nlevel = debug\n",
+		},
+		{
+			name:      "ini appends missing keys and sections",
+			format:    "ini",
+			content:   "top = 1\n[server]\nport = 80\n",
+			overrides: []patchOverride{{key: "global", value: "yes"}, {section: "server", key: "host", value: "0.0.0.0"}, {section: "new", key: "k", value: "v"}},
+			want:      "top = 1\nglobal = yes\n[server]\nport = 80\nhost = 0.0.0.0\n\n[new]\nk = v\n",
+		},
+		{
+			name:      "ini appends after the last key, not comments",
+			format:    "ini",
+			content:   "[a]\n;key = old\n#key = old\n",
+			overrides: []patchOverride{{section: "a", key: "key", value: "new"}},
+			want:      "[a]\nkey = new\n;key = old\n#key = old\n",
+		},
+		{
+			name:      "empty file",
+			format:    "ini",
+			content:   "",
+			overrides: []patchOverride{{section: "s", key: "k", value: "v"}},
+			want:      "[s]\nk = v\n",
+		},
+		{
+			name:      "toml quotes strings",
+			format:    "toml",
+			content:   "title = \"old\"\n[db]\nport = 5432\n",
+			overrides: []patchOverride{{key: "title", value: "new"}, {section: "db", key: "port", value: "6543"}, {section: "db", key: "ssl", value: "true"}},
+			want:      "title = \"new\"\n[db]\nport = 6543\nssl = true\n",
+		},
+		{
+			name:      "toml arrays of tables are not addressed",
+			format:    "toml",
+			content:   "[[servers]]\nname = \"a\"\n",
+			overrides: []patchOverride{{section: "servers", key: "name", value: "b"}},
+			want:      "[[servers]]\nname = \"a\"\n\n[servers]\nname = \"b\"\n",
+		},
+		{
+			name:      "properties",
+			format:    "properties",
+			content:   "! comment\na=1\nb: 2\nc = 3\n",
+			overrides: []patchOverride{{key: "b", value: "two words"}, {key: "c", value: "x=y"}, {key: "d", value: "4"}},
+			want:      "! comment\na=1\nb: two words\nc = x=y\nd=4\n",
+		},
+		{
+			name:      "without trailing newline",
+			format:    "properties",
+			content:   "a=1",
+			overrides: []patchOverride{{key: "a", value: "2"}},
+			want:      "a=2",
+		},
+	}
+	for _, tt := range tests {
+		got := patchKeyValue([]byte(tt.content), tt.overrides, tt.format)
+		if string(got) != tt.want {
+			t.Errorf("%s: patchKeyValue = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPatchValue(t *testing.T) {
+	tests := []struct {
+		value, format, want string
+	}{
+		{"plain", "toml", `"plain"`},
+		{"with \"quotes\"", "toml", `"with \"quotes\""`},
+		{`C:\path`, "toml", `"C:\\path"`},
+		{"", "toml", `""`},
+		{"true", "toml", "true"},
+		{"True", "toml", `"True"`},
+		{"42", "toml", "42"},
+		{"-1.5e3", "toml", "-1.5e3"},
+		{"1_000", "toml", "1_000"},
+		{`"already"`, "toml", `"already"`},
+		{"'literal'", "toml", "'literal'"},
+		{"[1, 2]", "toml", "[1, 2]"},
+		{"{ a = 1 }", "toml", "{ a = 1 }"},
+		{"plain", "ini", "plain"},
+		{"a b", "properties", "a b"},
+	}
+	for _, tt := range tests {
+		if got := formatPatchValue(tt.value, tt.format); got != tt.want {
+			t.Errorf("formatPatchValue(%q, %s) = %s, want %s", tt.value, tt.format, got, tt.want)
+		}
+	}
+}
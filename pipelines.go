@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// pipelineName matches a valid ENVWARP_PIPELINES entry.
+var pipelineName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// pipelineSettings are the settings a pipeline does not inherit from the
+// top-level configuration and has to define itself.
+var pipelineSettings = []string{"ENVWARP_TEMPLATE", "ENVWARP_CONFDIR", "ENVWARP_VALIDATE"}
+
+// loadPipelines returns the render pipelines listed in ENVWARP_PIPELINES
+// (comma-separated).
+func loadPipelines() ([]string, error) {
+	var pipelines []string
+	seen := map[string]bool{}
+	for _, name := range splitList(os.Getenv("ENVWARP_PIPELINES")) {
+		if !pipelineName.MatchString(name) {
+			return nil, fmt.Errorf("invalid pipeline name %q", name)
+		}
+		prefix := pipelinePrefix(name)
+		if seen[prefix] {
+			return nil, fmt.Errorf("duplicate pipeline %q", name)
+		}
+		seen[prefix] = true
+		pipelines = append(pipelines, name)
+	}
+	return pipelines, nil
+}
+
+// pipelinePrefix returns the prefix of the variables configuring a pipeline,
+// e.g. ENVWARP_PIPELINE_NGINX_ for nginx.
+func pipelinePrefix(name string) string {
+	return "ENVWARP_PIPELINE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// runPipelines renders and validates each pipeline in turn and returns the
+// paths of all written output files.
+func runPipelines(pipelines []string, customEnv []string) ([]string, error) {
+	var outputs []string
+	for _, name := range pipelines {
+		log.Printf("Running pipeline: %s", name)
+		pipelineOutputs, err := runPipeline(name, customEnv)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", name, err)
+		}
+		outputs = append(outputs, pipelineOutputs...)
+	}
+	return outputs, nil
+}
+
+// runPipeline renders one pipeline with its ENVWARP_PIPELINE_<NAME>_<SETTING>
+// variables applied as ENVWARP_<SETTING>, restoring the environment
+// afterwards. Its ENVWARP_VALIDATE command is run right after rendering.
+func runPipeline(name string, customEnv []string) ([]string, error) {
+	saved := os.Environ()
+	defer restoreEnvironment(saved)
+
+	for _, key := range pipelineSettings {
+		os.Unsetenv(key)
+	}
+	prefix := pipelinePrefix(name)
+	for _, env := range saved {
+		key, value, _ := strings.Cut(env, "=")
+		if setting, ok := strings.CutPrefix(key, prefix); ok && setting != "" {
+			os.Setenv("ENVWARP_"+setting, value)
+		}
+	}
+
+	templatePath := os.Getenv("ENVWARP_TEMPLATE")
+	confDir := os.Getenv("ENVWARP_CONFDIR")
+	if templatePath == "" || confDir == "" {
+		return nil, fmt.Errorf("%sTEMPLATE and %sCONFDIR must be set", prefix, prefix)
+	}
+
+	var snapshot *configSnapshot
+	if os.Getenv("ENVWARP_VALIDATE") != "" && envEnabled("ENVWARP_ROLLBACK") {
+		var err error
+		if snapshot, err = takeSnapshot(confDir); err != nil {
+			return nil, fmt.Errorf("failed to save previous config: %w", err)
+		}
+	}
+	outputs, err := renderConfig(templatePath, confDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(snapshot, customEnv); err != nil {
+		return nil, err
+	}
+	pruneAfterRender(confDir)
+	return outputs, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultPlaceholderPattern matches ${VAR} references left in rendered output.
+const defaultPlaceholderPattern = `\$\{[A-Za-z_][A-Za-z0-9_]*\}`
+
+// checkPlaceholders scans rendered contents, and the staged files of
+// streamed templates, for text that still looks like an unresolved
+// placeholder, e.g. a reference escaped by mistake or written for another
+// engine. Matches are reported by output file and line. ENVWARP_PLACEHOLDERS is one of "warn" (default),
+// "fail" or "ignore"; ENVWARP_PLACEHOLDER_PATTERN overrides the pattern.
+func checkPlaceholders(jobs []renderJob, contents [][]byte) error {
+	mode := os.Getenv("ENVWARP_PLACEHOLDERS")
+	switch mode {
+	case "", "warn", "fail":
+	case "ignore":
+		return nil
+	default:
+		return fmt.Errorf("invalid ENVWARP_PLACEHOLDERS value %q, must be one of warn, fail, ignore", mode)
+	}
+	// Unset references are left in the output on purpose in passthrough mode
+	if passthroughMode() {
+		return nil
+	}
+
+	pattern := os.Getenv("ENVWARP_PLACEHOLDER_PATTERN")
+	if pattern == "" {
+		pattern = defaultPlaceholderPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_PLACEHOLDER_PATTERN: %w", err)
+	}
+
+	var found []string
+	for i, content := range contents {
+		if jobs[i].binary {
+			continue
+		}
+		name := strings.TrimPrefix(jobs[i].output, stdoutDir+string(filepath.Separator))
+		if name == "" {
+			name = jobs[i].source
+		}
+		var r io.Reader = bytes.NewReader(content)
+		if jobs[i].stream {
+			f, err := os.Open(jobs[i].staged)
+			if err != nil {
+				return fmt.Errorf("failed to read staged output of %s: %w", jobs[i].source, err)
+			}
+			r = f
+			defer f.Close()
+		}
+		matches, err := findPlaceholders(r, name, re)
+		if err != nil {
+			return fmt.Errorf("failed to read staged output of %s: %w", jobs[i].source, err)
+		}
+		found = append(found, matches...)
+	}
+
+	if len(found) > 0 && mode == "fail" {
+		return fmt.Errorf("unresolved placeholders in rendered output:\n  %s", strings.Join(found, "\n  "))
+	}
+	return nil
+}
+
+// findPlaceholders returns the matches of re in r as "name:line: match",
+// logging a warning for each. It reads line by line, so staged outputs too
+// large for memory can be scanned as well.
+func findPlaceholders(r io.Reader, name string, re *regexp.Regexp) ([]string, error) {
+	var found []string
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		for _, match := range re.FindAll(line, -1) {
+			found = append(found, fmt.Sprintf("%s:%d: %s", name, n, match))
+			log.Printf("Warning: %s:%d looks like an unresolved placeholder: %s", name, n, match)
+		}
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return found, err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// renderWorkers returns the number of templates rendered concurrently, from
+// ENVWARP_WORKERS (default: the number of CPUs).
+func renderWorkers() (int, error) {
+	value := os.Getenv("ENVWARP_WORKERS")
+	if value == "" {
+		return runtime.NumCPU(), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid ENVWARP_WORKERS %q, must be a positive integer", value)
+	}
+	return n, nil
+}
+
+// renderJobs renders all jobs with a pool of workers and returns their
+// contents in job order. Every template is rendered even if some fail, and
+// the failures are reported together.
+func renderJobs(jobs []renderJob) ([][]byte, error) {
+	workers, err := renderWorkers()
+	if err != nil {
+		return nil, err
+	}
+
+	budget, err := newOutputBudget()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(jobs))
+	for i, job := range jobs {
+		names[i] = job.source
+	}
+	progress, err := newRenderProgress(names)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([][]byte, len(jobs))
+	errs := make([]error, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				progress.begin(i)
+				switch {
+				case jobs[i].stream:
+					jobs[i].staged, errs[i] = renderStream(jobs[i], budget)
+				case jobs[i].binary:
+					contents[i], errs[i] = jobs[i].body, budget.take(len(jobs[i].body))
+				default:
+					contents[i], errs[i] = renderBody(jobs[i], budget)
+				}
+				progress.finish(i)
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var failures templateErrors
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, renderFailures(jobs[i], err)...)
+			failed++
+		}
+	}
+	progress.close(failed)
+	if len(failures) > 0 {
+		return nil, failures
+	}
+	return contents, nil
+}
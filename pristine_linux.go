@@ -0,0 +1,75 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// pristineEnv implements ENVWARP_PRISTINE. envwarp stores its environment in
+// an anonymous memory file and re-executes itself with an empty environment,
+// so bootstrap variables no longer show up in /proc/<pid>/environ while it
+// renders or stays resident. The re-executed process restores the variables
+// from the memory file and closes it, keeping it from the command.
+func pristineEnv() error {
+	if value, ok := os.LookupEnv("ENVWARP_PRISTINE_FD"); ok {
+		return restorePristineEnv(value)
+	}
+	if !envEnabled("ENVWARP_PRISTINE") {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// No MFD_CLOEXEC: the descriptor must survive exec.
+	fd, err := unix.MemfdCreate("envwarp-env", 0)
+	if err != nil {
+		return fmt.Errorf("memfd_create: %w", err)
+	}
+	data := []byte(strings.Join(os.Environ(), "\x00"))
+	for len(data) > 0 {
+		n, err := unix.Write(fd, data)
+		if err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("failed to write memfd: %w", err)
+		}
+		data = data[n:]
+	}
+
+	log.Print("Re-executing with a pristine environment")
+	return unix.Exec(exe, os.Args, []string{"ENVWARP_PRISTINE_FD=" + strconv.Itoa(fd)})
+}
+
+// restorePristineEnv loads the environment handed over by pristineEnv.
+func restorePristineEnv(value string) error {
+	os.Unsetenv("ENVWARP_PRISTINE_FD")
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_PRISTINE_FD %q", value)
+	}
+	f := os.NewFile(uintptr(fd), "envwarp-env")
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if key, val, ok := strings.Cut(string(entry), "="); ok {
+			os.Setenv(key, val)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// pristineEnv is only supported on Linux.
+func pristineEnv() error {
+	if envEnabled("ENVWARP_PRISTINE") {
+		return errors.New("ENVWARP_PRISTINE is only supported on linux")
+	}
+	return nil
+}
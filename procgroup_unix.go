@@ -0,0 +1,43 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+)
+
+// applyProcessGroup puts envwarp into a new session or process group before
+// exec, according to ENVWARP_SETSID and ENVWARP_SETPGID.
+func applyProcessGroup() error {
+	if envEnabled("ENVWARP_SETSID") {
+		if _, err := syscall.Setsid(); err != nil {
+			// A process group leader, e.g. PID 1 in a container, cannot create a new session.
+			if !errors.Is(err, syscall.EPERM) {
+				return fmt.Errorf("setsid failed: %w", err)
+			}
+			log.Printf("Warning: setsid not permitted, already a process group leader")
+		} else {
+			log.Println("Started new session")
+		}
+		return nil
+	}
+	if envEnabled("ENVWARP_SETPGID") {
+		if err := syscall.Setpgid(0, 0); err != nil {
+			return fmt.Errorf("setpgid failed: %w", err)
+		}
+		log.Println("Started new process group")
+	}
+	return nil
+}
+
+// childSysProcAttr returns the session and process group attributes for
+// supervised child processes.
+func childSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid:  envEnabled("ENVWARP_SETSID"),
+		Setpgid: envEnabled("ENVWARP_SETPGID") && !envEnabled("ENVWARP_SETSID"),
+	}
+}
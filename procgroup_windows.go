@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// applyProcessGroup is not supported on Windows.
+func applyProcessGroup() error {
+	if envEnabled("ENVWARP_SETSID") || envEnabled("ENVWARP_SETPGID") {
+		return errors.New("sessions and process groups are not supported on windows")
+	}
+	return nil
+}
+
+// childSysProcAttr returns the default attributes on Windows.
+func childSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProgressInterval = 5 * time.Second
+	progressBarWidth        = 30
+)
+
+// renderProgress reports the progress of a render, so a large template tree
+// does not look hung: either as a bar redrawn in place when stderr is a
+// terminal, or as a log line every ENVWARP_PROGRESS_INTERVAL.
+type renderProgress struct {
+	names   []string
+	total   int
+	bar     bool
+	start   time.Time
+	mu      sync.Mutex
+	done    int
+	current string
+	// finished marks rendered templates; logged counts those logged so far.
+	finished []bool
+	logged   int
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// newRenderProgress starts reporting progress for the named templates
+// according to ENVWARP_PROGRESS: auto (default), bar, log or off.
+func newRenderProgress(names []string) (*renderProgress, error) {
+	p := &renderProgress{
+		names:    names,
+		total:    len(names),
+		start:    time.Now(),
+		finished: make([]bool, len(names)),
+		stop:     make(chan struct{}),
+	}
+	mode := os.Getenv("ENVWARP_PROGRESS")
+	switch mode {
+	case "", "auto":
+		p.bar = stderrIsTerminal()
+	case "bar":
+		p.bar = true
+	case "log", "off":
+	default:
+		return nil, fmt.Errorf("invalid ENVWARP_PROGRESS value %q, must be one of auto, bar, log, off", mode)
+	}
+
+	interval := defaultProgressInterval
+	if value := os.Getenv("ENVWARP_PROGRESS_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid ENVWARP_PROGRESS_INTERVAL %q, must be a positive duration", value)
+		}
+		interval = d
+	}
+	if !p.bar && mode != "off" {
+		p.stopped.Add(1)
+		go p.logEvery(interval)
+	}
+	return p, nil
+}
+
+// stderrIsTerminal reports whether stderr is attached to a terminal.
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// begin records that template i started rendering.
+func (p *renderProgress) begin(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = p.names[i]
+	if p.bar {
+		p.draw()
+	}
+}
+
+// finish records that template i finished rendering. Without a bar, each
+// template is logged once all templates before it are done, so the log has
+// the same order in every run regardless of how workers are scheduled.
+func (p *renderProgress) finish(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.finished[i] = true
+	if p.bar {
+		p.draw()
+		return
+	}
+	for p.logged < p.total && p.finished[p.logged] {
+		log.Printf("Processing template: %s", p.names[p.logged])
+		p.logged++
+	}
+}
+
+// draw redraws the progress bar in place; the caller holds p.mu.
+func (p *renderProgress) draw() {
+	filled := progressBarWidth
+	if p.total > 0 {
+		filled = p.done * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r%s[%s] %d/%d %s\x1b[K", log.Prefix(), bar, p.done, p.total, p.current)
+}
+
+// logEvery logs the progress until close is called.
+func (p *renderProgress) logEvery(interval time.Duration) {
+	defer p.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			log.Printf("Progress: %d/%d templates rendered (current: %s)", p.done, p.total, p.current)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// close stops reporting and logs a summary of the render.
+func (p *renderProgress) close(failed int) {
+	close(p.stop)
+	p.stopped.Wait()
+	if p.bar {
+		fmt.Fprintln(os.Stderr)
+	}
+	elapsed := time.Since(p.start).Round(time.Millisecond)
+	if failed > 0 {
+		log.Printf("Rendered %d/%d template(s) in %s, %d failed", p.total-failed, p.total, elapsed, failed)
+		return
+	}
+	log.Printf("Rendered %d template(s) in %s", p.total, elapsed)
+}
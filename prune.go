@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pruneEnabled reports whether ENVWARP_PRUNE is enabled.
+func pruneEnabled() bool {
+	return envEnabled("ENVWARP_PRUNE")
+}
+
+// pruneStale removes the files in confDir that the previous run recorded in
+// its manifest but this run did not write, so removed templates leave no
+// orphaned config behind on persistent volumes. Directories left empty are
+// removed too. Files envwarp never wrote are not touched.
+func pruneStale(confDir string, outputs []string) error {
+	path := manifestPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var previous renderManifest
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	root, err := filepath.Abs(confDir)
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, output := range outputs {
+		if abs, err := filepath.Abs(output); err == nil {
+			current[abs] = true
+		}
+	}
+	for _, entry := range previous.Files {
+		if current[entry.Output] {
+			continue
+		}
+		rel, err := filepath.Rel(root, entry.Output)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(entry.Output); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		log.Printf("Pruned stale file: %s", entry.Output)
+		removeEmptyDirs(filepath.Dir(entry.Output), root)
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including,
+// root for as long as they are empty.
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		// Remove fails on directories that are not empty
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
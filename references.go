@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// referencePrefixes are value prefixes that look like secret references.
+// Only filePrefix is resolved by envwarp; the others are reference schemes
+// of other tools and most likely indicate a misconfiguration. Dotted names
+// such as vault. are left out, as they match ordinary hostnames.
+var referencePrefixes = []string{filePrefix, "vault:", "ssm:", "ref+"}
+
+// checkUnresolvedReferences scans the environment for values that still look
+// like secret references, e.g. because the referenced file does not exist.
+// mode is one of "warn" (default), "fail" or "ignore".
+func checkUnresolvedReferences(mode string) error {
+	switch mode {
+	case "", "warn", "fail":
+	case "ignore":
+		return nil
+	default:
+		return fmt.Errorf("invalid ENVWARP_UNRESOLVED value %q, must be one of warn, fail, ignore", mode)
+	}
+
+	var unresolved []string
+	for _, env := range os.Environ() {
+		name, value, ok := strings.Cut(env, "=")
+		if _, private := privateSecrets[name]; !ok || private || strings.HasSuffix(name, "_FILE") {
+			continue
+		}
+		for _, prefix := range referencePrefixes {
+			if strings.HasPrefix(value, prefix) {
+				unresolved = append(unresolved, name)
+				log.Printf("Warning: %s looks like an unresolved reference: %s", name, value)
+				break
+			}
+		}
+	}
+
+	if len(unresolved) > 0 && mode == "fail" {
+		sort.Strings(unresolved)
+		return fmt.Errorf("unresolved references in: %s", strings.Join(unresolved, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const refreshPrefix = "ENVWARP_REFRESH_"
+
+// secretRefs maps the variables resolved from file. references to their
+// secret files, so watch mode can read them again.
+var secretRefs = map[string]string{}
+
+// secretRefresh is a file. secret that watch mode reads again periodically.
+type secretRefresh struct {
+	name     string
+	interval time.Duration
+}
+
+// secretRefreshes returns the file. secrets to refresh and how often:
+// ENVWARP_REFRESH_<NAME> for a single variable, or else the default from
+// ENVWARP_SECRET_REFRESH. An interval of 0 reads the secret only once, which
+// is also the default, so static config is never fetched again.
+func secretRefreshes() ([]secretRefresh, error) {
+	fallback, err := refreshInterval("ENVWARP_SECRET_REFRESH")
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, refreshPrefix)
+		if !ok {
+			continue
+		}
+		if _, ok := secretRefs[name]; !ok {
+			return nil, fmt.Errorf("%s is set, but %s is not resolved from a %s reference", key, name, filePrefix)
+		}
+	}
+
+	var refreshes []secretRefresh
+	for name := range secretRefs {
+		interval := fallback
+		if _, ok := os.LookupEnv(refreshPrefix + name); ok {
+			if interval, err = refreshInterval(refreshPrefix + name); err != nil {
+				return nil, err
+			}
+		}
+		if interval > 0 {
+			refreshes = append(refreshes, secretRefresh{name: name, interval: interval})
+		}
+	}
+	sort.Slice(refreshes, func(i, j int) bool { return refreshes[i].name < refreshes[j].name })
+	return refreshes, nil
+}
+
+// refreshInterval parses the refresh interval in the variable key.
+func refreshInterval(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q, must be a non-negative duration", key, value)
+	}
+	return d, nil
+}
+
+// refreshSecret reads the secret file of name again and reports whether its
+// value changed. A changed value replaces the one used for rendering, which
+// stays private if the original had left the environment, and is also
+// written to ENVWARP_SECRETS_OUTDIR, if set.
+func refreshSecret(name string) (bool, error) {
+	secretPath := secretRefs[name]
+	value, ok, err := readSecretFile(secretPath)
+	if err != nil {
+		return false, err
+	}
+	if !ok || value == lookupVar(name) {
+		return false, nil
+	}
+	if _, ok := privateSecrets[name]; ok {
+		privateSecrets[name] = value
+	} else if err := setSecret(name, value); err != nil {
+		return false, fmt.Errorf("failed to set env var %s from secret file: %w", name, err)
+	}
+	log.Printf("Refreshed secret for %s from %s", name, secretPath)
+	if secretsDir := os.Getenv("ENVWARP_SECRETS_OUTDIR"); secretsDir != "" {
+		if err := writeSecretFile(secretsDir, name, value); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// runRender processes templates without executing a command afterwards.
+// With --env-only-from, the process environment is discarded and only the
+// given files are used, making renders reproducible regardless of the runner.
+// With --stdout, the output is printed instead of written, and an optional
+// template argument overrides ENVWARP_TEMPLATE. A template argument of "-"
+// reads the template from stdin and prints the result, like envsubst.
+func runRender(args []string) {
+	var envFiles, envOnlyFiles, templateFlags stringSlice
+	renderCmd := flag.NewFlagSet("render", flag.ExitOnError)
+	renderCmd.Var(&envFiles, "e", "path to a custom environment file (can be specified multiple times)")
+	renderCmd.Var(&envFiles, "env", "path to a custom environment file (can be specified multiple times)")
+	renderCmd.Var(&envOnlyFiles, "env-only-from", "ignore the process environment and render only from this file (can be specified multiple times)")
+	renderCmd.Var(&templateFlags, "template", "template file or directory to render (can be specified multiple times, overrides ENVWARP_TEMPLATE)")
+	tagsFlag := renderCmd.String("tags", "", "comma-separated template tags to render (overrides ENVWARP_TAGS)")
+	extFlag := renderCmd.String("template-ext", "", "comma-separated template file extensions (overrides ENVWARP_TEMPLATE_EXT)")
+	binaryFlag := renderCmd.String("binary", "", "how to handle binary templates: fail or copy (overrides ENVWARP_BINARY)")
+	strictFlag := renderCmd.Bool("strict", false, "fail on unset variables referenced by templates (same as ENVWARP_STRICT=1)")
+	passthroughFlag := renderCmd.Bool("passthrough", false, "leave references to unset variables in the output as they are (same as ENVWARP_PASSTHROUGH=1)")
+	keepTempFlag := renderCmd.Bool("keep-temp", false, "keep the temporary directory for debugging (same as ENVWARP_KEEP_TEMP=1)")
+	dryRunFlag := renderCmd.Bool("dry-run", false, "print a diff of the changes rendering would make and exit")
+	stdoutFlag := renderCmd.Bool("stdout", false, "print rendered output to stdout instead of writing files (same as ENVWARP_CONFDIR=-)")
+	renderCmd.Parse(args)
+
+	if len(envOnlyFiles) > 0 {
+		os.Clearenv()
+		envFiles = append(envOnlyFiles, envFiles...)
+	}
+	if len(envFiles) > 0 {
+		if err := loadEnvFiles(envFiles); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	// Flags are applied after the environment is replaced, so --env-only-from
+	// does not discard them.
+	setEnvFlag("ENVWARP_TAGS", *tagsFlag)
+	setEnvFlag("ENVWARP_TEMPLATE_EXT", *extFlag)
+	setStrictFlag(*strictFlag)
+	setEnvFlag("ENVWARP_BINARY", *binaryFlag)
+	setKeepTempFlag(*keepTempFlag)
+	setTemplateFlag(templateFlags)
+	setPassthroughFlag(*passthroughFlag)
+
+	secretsDir := os.Getenv("ENVWARP_SECRETS_OUTDIR")
+	if *dryRunFlag {
+		secretsDir = ""
+	}
+	if err := processSecrets(secretsDir); err != nil {
+		log.Fatalf("Error: Failed to process secrets: %v", err)
+	}
+
+	templatePath := os.Getenv("ENVWARP_TEMPLATE")
+	confDir := os.Getenv("ENVWARP_CONFDIR")
+	if *stdoutFlag {
+		confDir = stdoutDir
+	}
+	if renderCmd.NArg() > 0 {
+		templatePath = renderCmd.Arg(0)
+	}
+	if templatePath == "-" {
+		if err := renderStdin(); err != nil {
+			log.Fatalf("Error: Failed to render stdin: %v", err)
+		}
+		os.Exit(0)
+	}
+	if *dryRunFlag {
+		os.Exit(runDryRun(templatePath, confDir))
+	}
+	if templatePath == "" || confDir == "" {
+		log.Fatal("Error: ENVWARP_TEMPLATE and ENVWARP_CONFDIR environment variables must be set.")
+	}
+
+	// Large templates are staged in the scratch directory
+	metrics := startMetrics()
+	emitEvent(lifecycleEvent{Event: "render-start"})
+	outputs, err := renderConfig(templatePath, confDir)
+	cleanupScratch()
+	if err != nil {
+		failRender(metrics, "Error: Failed to process templates: %v", err)
+	}
+	pruneAfterRender(confDir)
+
+	metrics.rendered(outputs)
+	log.Println("All templates processed successfully.")
+	emitEvent(renderedEvent(metrics, outputs))
+	metrics.push(true)
+	os.Exit(0)
+}
+
+// renderStdin renders a template read from stdin to stdout. Only errors and
+// warnings are logged, so it can stand in for envsubst in shell scripts.
+func renderStdin() error {
+	raw, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	binaryMode, err := binaryTemplateMode()
+	if err != nil {
+		return err
+	}
+	job, fm, terr := parseTemplate("-", raw, nil, binaryMode)
+	if terr != nil {
+		return terr
+	}
+
+	content := job.body
+	if !job.binary {
+		job.engine, job.directives, job.escape = templateEngine(fm), fm.directives(), fm["escape"]
+		if err := checkEngine(job.engine, job.escape); err != nil {
+			return err
+		}
+		budget, err := newOutputBudget()
+		if err != nil {
+			return err
+		}
+		if content, err = renderBody(job, budget); err != nil {
+			return renderFailures(job, err)
+		}
+		if err := checkPlaceholders([]renderJob{job}, [][]byte{content}); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stdout.Write(content); err != nil {
+		return fmt.Errorf("failed to write to stdout: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRenderHelperProcess runs the render subcommand with the arguments
+// after "--" when started by runRenderCommand, since it exits the process.
+func TestRenderHelperProcess(t *testing.T) {
+	if os.Getenv("ENVWARP_TEST_RENDER") != "1" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	runRender(args)
+	os.Exit(0)
+}
+
+// runRenderCommand runs envwarp render in dir and returns its stdout and
+// whether it succeeded.
+func runRenderCommand(t *testing.T, dir string, args ...string) (string, bool) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestRenderHelperProcess$", "--"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "ENVWARP_TEST_RENDER=1")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Logf("render %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out), err == nil
+}
+
+// The render flags are applied to the environment, which --env-only-from
+// used to clear right afterwards.
+func TestRenderEnvOnlyFromKeepsFlags(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"tpl", "strict"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"ci.env":          "NAME=from-env-file\n",
+		"tpl/app.conf.in": "name=${NAME}\n",
+		"strict/app.in":   "missing=${MISSING}\n",
+		"tpl/other.conf":  "not a template\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("NAME", "from-process")
+
+	out, ok := runRenderCommand(t, dir, "--env-only-from", "ci.env", "--template", "tpl", "--template-ext", ".in", "--stdout")
+	if !ok || out != "name=from-env-file\n" {
+		t.Errorf("render printed %q, %v, want %q", out, ok, "name=from-env-file\n")
+	}
+	if _, ok := runRenderCommand(t, dir, "--env-only-from", "ci.env", "--template", "strict", "--template-ext", ".in", "--strict", "--stdout"); ok {
+		t.Error("render --strict succeeded with an unset variable, want failure")
+	}
+	if out, ok := runRenderCommand(t, dir, "--env-only-from", "ci.env", "--template", "strict", "--template-ext", ".in", "--passthrough", "--stdout"); !ok || out != "missing=${MISSING}\n" {
+		t.Errorf("render --passthrough printed %q, %v, want the reference kept", out, ok)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultFSRetries    = 3
+	defaultFSRetryDelay = 200 * time.Millisecond
+)
+
+// transientFSErrors are the errors network filesystems such as NFS and EFS
+// return while a volume is still attaching or failing over.
+var transientFSErrors = []error{
+	syscall.EIO,
+	syscall.ESTALE,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.ETIMEDOUT,
+}
+
+// fsRetryPolicy returns how often a transient filesystem error is retried,
+// from ENVWARP_FS_RETRIES (default 3), and the delay before the first retry,
+// from ENVWARP_FS_RETRY_DELAY (default 200ms). The delay doubles on every
+// further attempt.
+func fsRetryPolicy() (int, time.Duration, error) {
+	retries, delay := defaultFSRetries, defaultFSRetryDelay
+	if value := os.Getenv("ENVWARP_FS_RETRIES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_FS_RETRIES %q, must be a non-negative integer", value)
+		}
+		retries = n
+	}
+	if value := os.Getenv("ENVWARP_FS_RETRY_DELAY"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_FS_RETRY_DELAY %q, must be a non-negative duration", value)
+		}
+		delay = d
+	}
+	return retries, delay, nil
+}
+
+// isTransientFSError reports whether err is worth retrying.
+func isTransientFSError(err error) bool {
+	for _, transient := range transientFSErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryFS runs a filesystem operation on path, retrying it with exponential
+// backoff while it fails with a transient error. Other errors are returned
+// right away.
+func retryFS(path string, op func() error) error {
+	retries, delay, err := fsRetryPolicy()
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt > retries || !isTransientFSError(err) {
+			return err
+		}
+		log.Printf("Warning: Transient error on %s, retrying in %s (%d/%d): %v", path, delay, attempt, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// snapshotFile is the saved content of a file before rendering.
+type snapshotFile struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// configSnapshot is the previous generation of the rendered config: every
+// regular file under the output directory plus the patch target. With
+// ENVWARP_GENERATIONS, the previous generation directory is kept on disk and
+// only its name is recorded.
+type configSnapshot struct {
+	confDir    string
+	generation string
+	files      map[string]snapshotFile
+}
+
+// takeSnapshot saves the current contents of confDir and any extra files so
+// they can be restored if the new render fails validation.
+func takeSnapshot(confDir string, extra ...string) (*configSnapshot, error) {
+	snap := &configSnapshot{confDir: confDir, files: map[string]snapshotFile{}}
+	if generationsEnabled() {
+		generation, err := currentGeneration(confDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current generation: %w", err)
+		}
+		snap.generation = generation
+		return snap, snap.addExtra(extra)
+	}
+	err := filepath.WalkDir(confDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == confDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			return snap.add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %w", confDir, err)
+	}
+	return snap, snap.addExtra(extra)
+}
+
+func (s *configSnapshot) addExtra(paths []string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := s.add(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to snapshot %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (s *configSnapshot) add(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.files[path] = snapshotFile{data: data, mode: fi.Mode().Perm()}
+	return nil
+}
+
+// empty reports whether there was no previous generation to restore.
+func (s *configSnapshot) empty() bool {
+	if generationsEnabled() {
+		return s.generation == ""
+	}
+	return len(s.files) == 0
+}
+
+// restore writes back the saved files and removes files created under the
+// output directory since the snapshot was taken. With generations, the
+// current symlink is switched back to the previous generation instead.
+func (s *configSnapshot) restore() error {
+	if s.generation != "" {
+		if err := activateGeneration(s.confDir, s.generation); err != nil {
+			return err
+		}
+		return s.restoreFiles()
+	}
+	err := filepath.WalkDir(s.confDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := s.files[path]; !ok && d.Type().IsRegular() {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clean %s: %w", s.confDir, err)
+	}
+	return s.restoreFiles()
+}
+
+func (s *configSnapshot) restoreFiles() error {
+	for path, f := range s.files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, f.data, f.mode); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// validateConfig runs ENVWARP_VALIDATE against the freshly rendered config.
+// If validation fails and ENVWARP_ROLLBACK is enabled, the previous
+// generation is restored and startup continues with it.
+func validateConfig(snap *configSnapshot, customEnv []string) error {
+	command := os.Getenv("ENVWARP_VALIDATE")
+	if command == "" {
+		return nil
+	}
+	parts, err := splitCommand(command)
+	if err != nil {
+		return fmt.Errorf("invalid ENVWARP_VALIDATE: %w", err)
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+
+	log.Printf("Validating rendered config: %s", command)
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = childEnvironment(customEnv)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	verr := cmd.Run()
+	if verr == nil {
+		return nil
+	}
+
+	if !envEnabled("ENVWARP_ROLLBACK") || snap == nil {
+		return fmt.Errorf("validation command failed: %w", verr)
+	}
+	if snap.empty() {
+		return fmt.Errorf("validation command failed and there is no previous config to restore: %w", verr)
+	}
+	if err := snap.restore(); err != nil {
+		return fmt.Errorf("validation command failed (%v) and rollback failed: %w", verr, err)
+	}
+	log.Printf("Warning: Validation failed (%v), restored previous config", verr)
+	return nil
+}
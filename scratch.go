@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// scratchRoot is the per-run scratch directory, created on first use.
+var scratchRoot string
+
+// scratchDir returns the per-run scratch directory, creating it below
+// ENVWARP_TMPDIR (default: the system temporary directory) on first use.
+// Its path is exported as ENVWARP_SCRATCH_DIR until it is cleaned up.
+func scratchDir() (string, error) {
+	if scratchRoot != "" {
+		return scratchRoot, nil
+	}
+	base := os.Getenv("ENVWARP_TMPDIR")
+	if base != "" {
+		if err := os.MkdirAll(base, 0700); err != nil {
+			return "", fmt.Errorf("failed to create ENVWARP_TMPDIR: %w", err)
+		}
+	}
+	dir, err := os.MkdirTemp(base, "envwarp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	scratchRoot = dir
+	os.Setenv("ENVWARP_SCRATCH_DIR", dir)
+	return dir, nil
+}
+
+// scratchTemp creates a new directory inside the scratch directory.
+func scratchTemp(pattern string) (string, error) {
+	root, err := scratchDir()
+	if err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(root, pattern)
+}
+
+// cleanupScratch removes the scratch directory, unless ENVWARP_KEEP_TEMP
+// (or --keep-temp) keeps it around for debugging.
+func cleanupScratch() {
+	if scratchRoot == "" {
+		return
+	}
+	if envEnabled("ENVWARP_KEEP_TEMP") {
+		log.Printf("Keeping temporary directory: %s", scratchRoot)
+		return
+	}
+	if err := os.RemoveAll(scratchRoot); err != nil {
+		log.Printf("Warning: Failed to remove temporary directory %s: %v", scratchRoot, err)
+	}
+	os.Unsetenv("ENVWARP_SCRATCH_DIR")
+	scratchRoot = ""
+}
+
+// fatalf removes the scratch directory and exits like log.Fatalf, as
+// deferred cleanups do not run on os.Exit.
+func fatalf(format string, v ...any) {
+	cleanupScratch()
+	log.Fatalf(format, v...)
+}
+
+// setKeepTempFlag applies a --keep-temp flag, which enables ENVWARP_KEEP_TEMP.
+func setKeepTempFlag(keep bool) {
+	if keep {
+		os.Setenv("ENVWARP_KEEP_TEMP", "true")
+	}
+}
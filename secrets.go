@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// privateSecrets holds secrets resolved while ENVWARP_SECRETS_PRIVATE is
+// enabled. They are used for rendering but kept out of the process
+// environment until exportSecrets hands the selected ones to the child.
+var privateSecrets = map[string]string{}
+
+// setSecret stores a resolved secret, either in the process environment or,
+// in private mode, in privateSecrets.
+func setSecret(name, value string) error {
+	if envEnabled("ENVWARP_SECRETS_PRIVATE") {
+		privateSecrets[name] = value
+		return nil
+	}
+	return os.Setenv(name, value)
+}
+
+// lookupVar returns a variable for rendering, preferring private secrets.
+func lookupVar(name string) string {
+	if value, ok := privateSecrets[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// renderEnviron returns the environment used for substitution: the process
+// environment overlaid with private secrets.
+func renderEnviron() []string {
+	env := os.Environ()
+	if len(privateSecrets) == 0 {
+		return env
+	}
+	result := make([]string, 0, len(env)+len(privateSecrets))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := privateSecrets[key]; !ok {
+			result = append(result, kv)
+		}
+	}
+	for key, value := range privateSecrets {
+		result = append(result, key+"="+value)
+	}
+	return result
+}
+
+// escapedEnviron returns the rendering environment with every value passed
+// through escape, unless it is nil.
+func escapedEnviron(escape func(string) string) []string {
+	env := renderEnviron()
+	if escape == nil {
+		return env
+	}
+	for i, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		env[i] = key + "=" + escape(value)
+	}
+	return env
+}
+
+// exportMemfdSecrets moves the secrets listed in ENVWARP_SECRETS_MEMFD
+// (comma-separated) into anonymous memory files inherited by the child. For
+// each secret, <NAME>_FILE is set to the /proc/self/fd path of its memfd and
+// <NAME> itself is removed from the child environment.
+func exportMemfdSecrets(childEnv []string) ([]string, error) {
+	for _, name := range splitList(os.Getenv("ENVWARP_SECRETS_MEMFD")) {
+		value, ok := privateSecrets[name]
+		if !ok {
+			if value, ok = os.LookupEnv(name); !ok || strings.HasPrefix(value, filePrefix) {
+				return nil, fmt.Errorf("secret %s listed in ENVWARP_SECRETS_MEMFD is not resolved", name)
+			}
+		}
+		path, err := createMemfd(name, []byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create memfd for %s: %w", name, err)
+		}
+		delete(privateSecrets, name)
+		childEnv = unexportEnv(childEnv, name)
+		childEnv = exportEnv(childEnv, name+"_FILE", path)
+		log.Printf("Passing secret %s to the command via %s", name, path)
+	}
+	return childEnv, nil
+}
+
+// unexportEnv removes an environment variable from envwarp and the executed
+// command, the counterpart of exportEnv.
+func unexportEnv(childEnv []string, key string) []string {
+	os.Unsetenv(key)
+	if childEnv == nil {
+		return nil
+	}
+	prefix := key + "="
+	result := childEnv[:0]
+	for _, env := range childEnv {
+		if !strings.HasPrefix(env, prefix) {
+			result = append(result, env)
+		}
+	}
+	return result
+}
+
+// retainSecrets returns a copy of the resolved secrets that
+// exportMemfdSecrets and exportSecrets remove from the environment, so watch
+// mode can still render them once the command has its environment.
+func retainSecrets() map[string]string {
+	kept := make(map[string]string, len(privateSecrets))
+	for name, value := range privateSecrets {
+		kept[name] = value
+	}
+	for _, name := range splitList(os.Getenv("ENVWARP_SECRETS_MEMFD")) {
+		if _, ok := kept[name]; ok {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			kept[name] = value
+		}
+	}
+	return kept
+}
+
+// restoreSecrets makes secrets saved by retainSecrets available for
+// rendering again. They are kept as private secrets, so they do not reach
+// the environment of commands started later.
+func restoreSecrets(kept map[string]string) {
+	for name, value := range kept {
+		privateSecrets[name] = value
+	}
+}
+
+// exportSecrets exports the private secrets listed in ENVWARP_CHILD_SECRETS
+// (comma-separated, or * for all) to the child and discards all of them, so
+// the rest never reach an environment.
+func exportSecrets(childEnv []string) []string {
+	selected := splitList(os.Getenv("ENVWARP_CHILD_SECRETS"))
+	for name, value := range privateSecrets {
+		for _, s := range selected {
+			if s == "*" || s == name {
+				childEnv = exportEnv(childEnv, name, value)
+				break
+			}
+		}
+		delete(privateSecrets, name)
+	}
+	return childEnv
+}
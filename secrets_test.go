@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// resetSecrets gives a test empty secret state and restores it afterwards.
+func resetSecrets(t *testing.T) {
+	savedPrivate, savedRefs := privateSecrets, secretRefs
+	privateSecrets, secretRefs = map[string]string{}, map[string]string{}
+	t.Cleanup(func() { privateSecrets, secretRefs = savedPrivate, savedRefs })
+}
+
+// writeSecret writes a secret file and returns its path.
+func writeSecret(t *testing.T, path, value string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		want    string
+		ok      bool
+	}{
+		{content: "", ok: false},
+		{content: "value", want: "value", ok: true},
+		{content: "value\n", want: "value", ok: true},
+		{content: "value\r\n", want: "value", ok: true},
+		{content: "value\n\n", want: "value\n", ok: true},
+		{content: "\n", want: "", ok: true},
+		{content: "-----BEGIN KEY-----\nAAAA\nBBBB\n-----END KEY-----\n", want: "-----BEGIN KEY-----\nAAAA\nBBBB\n-----END KEY-----", ok: true},
+	}
+	for i, tt := range tests {
+		path := writeSecret(t, filepath.Join(dir, strings.Repeat("s", i+1)), tt.content)
+		got, ok, err := readSecretFile(path)
+		if err != nil {
+			t.Errorf("readSecretFile(%q) failed: %v", tt.content, err)
+			continue
+		}
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("readSecretFile(%q) = %q, %v, want %q, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// Watch mode renders again after the private secrets were handed to the
+// command, which used to render the raw file. references instead.
+func TestWatchRendersPrivateSecrets(t *testing.T) {
+	resetSecrets(t)
+	secretPath := writeSecret(t, filepath.Join(t.TempDir(), "db"), "first\n")
+	t.Setenv("ENVWARP_SECRETS_PRIVATE", "1")
+	t.Setenv("ENVWARP_CHILD_SECRETS", "")
+	t.Setenv("WATCH_DB_PASSWORD", filePrefix+secretPath)
+	if err := processSecrets(""); err != nil {
+		t.Fatal(err)
+	}
+
+	retained := retainSecrets()
+	childEnv := exportSecrets([]string{})
+	restoreSecrets(retained)
+	if len(childEnv) != 0 {
+		t.Errorf("child environment = %q, want no secrets", childEnv)
+	}
+	if got, err := expandEnv("${WATCH_DB_PASSWORD}"); err != nil || got != "first" {
+		t.Errorf("rendered %q, %v after export, want %q", got, err, "first")
+	}
+
+	if changed, err := refreshSecret("WATCH_DB_PASSWORD"); err != nil || changed {
+		t.Errorf("refreshSecret of an unchanged file = %v, %v, want false", changed, err)
+	}
+	writeSecret(t, secretPath, "second\n")
+	if changed, err := refreshSecret("WATCH_DB_PASSWORD"); err != nil || !changed {
+		t.Errorf("refreshSecret of a changed file = %v, %v, want true", changed, err)
+	}
+	if got, err := expandEnv("${WATCH_DB_PASSWORD}"); err != nil || got != "second" {
+		t.Errorf("rendered %q, %v after refresh, want %q", got, err, "second")
+	}
+	if got := os.Getenv("WATCH_DB_PASSWORD"); got != filePrefix+secretPath {
+		t.Errorf("process environment has WATCH_DB_PASSWORD=%q, want the secret kept private", got)
+	}
+}
+
+// Secrets passed via memfd are removed from the environment, which used to
+// leave watch mode rendering them empty.
+func TestWatchRendersMemfdSecrets(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memfd secrets are only supported on linux")
+	}
+	resetSecrets(t)
+	secretPath := writeSecret(t, filepath.Join(t.TempDir(), "api"), "first\n")
+	t.Setenv("ENVWARP_SECRETS_MEMFD", "WATCH_API_KEY")
+	t.Setenv("WATCH_API_KEY", filePrefix+secretPath)
+	t.Setenv("WATCH_API_KEY_FILE", "")
+	if err := processSecrets(""); err != nil {
+		t.Fatal(err)
+	}
+
+	retained := retainSecrets()
+	childEnv, err := exportMemfdSecrets([]string{"WATCH_API_KEY=first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoreSecrets(retained)
+	if slices.Contains(childEnv, "WATCH_API_KEY=first") {
+		t.Errorf("child environment = %q, want the secret passed via memfd only", childEnv)
+	}
+	if got, err := expandEnv("${WATCH_API_KEY}"); err != nil || got != "first" {
+		t.Errorf("rendered %q, %v after export, want %q", got, err, "first")
+	}
+
+	writeSecret(t, secretPath, "second\n")
+	if changed, err := refreshSecret("WATCH_API_KEY"); err != nil || !changed {
+		t.Errorf("refreshSecret of a changed file = %v, %v, want true", changed, err)
+	}
+	if got, err := expandEnv("${WATCH_API_KEY}"); err != nil || got != "second" {
+		t.Errorf("rendered %q, %v after refresh, want %q", got, err, "second")
+	}
+	if value, ok := os.LookupEnv("WATCH_API_KEY"); ok {
+		t.Errorf("process environment has WATCH_API_KEY=%q, want it removed", value)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed from envwarp to a supervised child process.
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// reloadSignals are the signals ENVWARP_RELOAD_SIGNAL can name.
+var reloadSignals = map[string]os.Signal{
+	"SIGHUP": syscall.SIGHUP, "SIGUSR1": syscall.SIGUSR1, "SIGUSR2": syscall.SIGUSR2,
+}
+
+// reloadSignalNames lists the accepted ENVWARP_RELOAD_SIGNAL values.
+func reloadSignalNames() string {
+	return "SIGHUP, SIGUSR1, SIGUSR2"
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed from envwarp to a supervised child process.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// reloadSignals is empty, as Windows processes cannot be sent signals; use
+// ENVWARP_RELOAD_COMMAND instead.
+var reloadSignals = map[string]os.Signal{}
+
+// reloadSignalNames lists the accepted ENVWARP_RELOAD_SIGNAL values.
+func reloadSignalNames() string {
+	return "none on Windows, use ENVWARP_RELOAD_COMMAND"
+}
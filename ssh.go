@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultSSHKeyName = "id_ed25519"
+
+// setupSSH installs an SSH private key and known_hosts entries from environment
+// variables so that git/ssh work for the executed command.
+func setupSSH() error {
+	key := lookupVar("ENVWARP_SSH_KEY")
+	keyFile := os.Getenv("ENVWARP_SSH_KEY_FILE")
+	knownHosts := lookupVar("ENVWARP_SSH_KNOWN_HOSTS")
+
+	if key == "" && keyFile == "" && knownHosts == "" {
+		return nil
+	}
+
+	sshDir := os.Getenv("ENVWARP_SSH_DIR")
+	if sshDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot determine home directory for SSH setup: %w", err)
+		}
+		sshDir = filepath.Join(home, ".ssh")
+	}
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return fmt.Errorf("failed to create SSH directory '%s': %w", sshDir, err)
+	}
+	if err := os.Chmod(sshDir, 0700); err != nil {
+		return fmt.Errorf("failed to set permissions on SSH directory '%s': %w", sshDir, err)
+	}
+
+	// A key file takes precedence, as multi-line keys are awkward to pass inline.
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read SSH key file %s: %w", keyFile, err)
+		}
+		key = string(content)
+	}
+
+	if key != "" {
+		keyName := os.Getenv("ENVWARP_SSH_KEY_NAME")
+		if keyName == "" {
+			keyName = defaultSSHKeyName
+		}
+		keyPath := filepath.Join(sshDir, keyName)
+		// OpenSSH rejects private keys without a trailing newline.
+		if !strings.HasSuffix(key, "\n") {
+			key += "\n"
+		}
+		if err := writeFileAtomic(keyPath, []byte(key), 0600); err != nil {
+			return err
+		}
+		log.Printf("Installed SSH private key to: %s", keyPath)
+	}
+
+	if knownHosts != "" {
+		knownHostsPath := filepath.Join(sshDir, "known_hosts")
+		if !strings.HasSuffix(knownHosts, "\n") {
+			knownHosts += "\n"
+		}
+		if err := writeFileAtomic(knownHostsPath, []byte(knownHosts), 0644); err != nil {
+			return err
+		}
+		log.Printf("Populated SSH known_hosts: %s", knownHostsPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultStartupTimeout  = 60 * time.Second
+	defaultStartupInterval = time.Second
+)
+
+var (
+	errChildExited = errors.New("command exited before the startup check passed")
+	errShutdown    = errors.New("received a termination signal during the startup check")
+)
+
+// startupTiming returns how long the command may take to pass the startup
+// check, from ENVWARP_STARTUP_TIMEOUT (default 60s), and how often the check
+// is run, from ENVWARP_STARTUP_INTERVAL (default 1s).
+func startupTiming() (time.Duration, time.Duration, error) {
+	timeout, interval := defaultStartupTimeout, defaultStartupInterval
+	if value := os.Getenv("ENVWARP_STARTUP_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_STARTUP_TIMEOUT %q, must be a positive duration", value)
+		}
+		timeout = d
+	}
+	if value := os.Getenv("ENVWARP_STARTUP_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid ENVWARP_STARTUP_INTERVAL %q, must be a positive duration", value)
+		}
+		interval = d
+	}
+	return timeout, interval, nil
+}
+
+// runStartupGate starts argv supervised and runs the check command until it
+// passes. If the command exits or the check does not pass within the startup
+// timeout, and ENVWARP_ROLLBACK saved a previous config in snap, the command
+// is stopped, the previous config is restored and the command is started
+// again with it. envwarp stays resident to supervise the command and exits
+// with its exit code.
+func runStartupGate(check string, argv []string, customEnv []string, snap *configSnapshot) {
+	parts, err := splitCommand(check)
+	if err != nil || len(parts) == 0 {
+		log.Fatalf("Error: Invalid ENVWARP_STARTUP_CHECK %q", check)
+	}
+	timeout, interval, err := startupTiming()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	grace, err := stopGracePeriod()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	emitEvent(execEvent(argv))
+	child, err := startChild(argv, customEnv)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	exited := superviseChild(child, grace)
+
+	log.Printf("Waiting up to %s for the startup check to pass: %s", timeout, check)
+	var code int
+	switch gerr := awaitStartup(parts, customEnv, timeout, interval, exited); {
+	case gerr == nil:
+		log.Println("Startup check passed.")
+		if snap != nil {
+			pruneAfterRender(snap.confDir)
+		}
+		code = <-exited
+	case errors.Is(gerr, errShutdown):
+		code = <-exited
+	default:
+		if !errors.Is(gerr, errChildExited) {
+			stopChild(child, grace, exited)
+		}
+		if snap == nil {
+			log.Fatalf("Error: Startup check failed: %v", gerr)
+		}
+		if snap.empty() {
+			log.Fatalf("Error: Startup check failed and there is no previous config to restore: %v", gerr)
+		}
+		if err := snap.restore(); err != nil {
+			log.Fatalf("Error: Startup check failed (%v) and rollback failed: %v", gerr, err)
+		}
+		log.Printf("Warning: Startup check failed (%v), restored previous config", gerr)
+		if child, err = startChild(argv, customEnv); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		code = waitChild(child, grace)
+	}
+
+	if err := runPostExitHook(customEnv, code); err != nil {
+		log.Printf("Error: %v", err)
+	}
+	os.Exit(code)
+}
+
+// superviseChild waits for a started child in the background and returns a
+// channel that receives its exit code.
+func superviseChild(cmd *exec.Cmd, grace time.Duration) <-chan int {
+	exited := make(chan int, 1)
+	go func() {
+		exited <- waitChild(cmd, grace)
+	}()
+	return exited
+}
+
+// awaitStartup runs the check command every interval until it succeeds. It
+// fails once timeout has passed or the command has exited, and returns
+// errShutdown if envwarp is asked to stop in the meantime.
+func awaitStartup(parts []string, customEnv []string, timeout, interval time.Duration, exited <-chan int) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var lastErr error
+	for {
+		cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+		cmd.Env = childEnvironment(customEnv)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if out := strings.TrimSpace(string(output)); out != "" {
+			lastErr = fmt.Errorf("%v: %s", err, out)
+		}
+
+		select {
+		case code := <-exited:
+			return fmt.Errorf("%w with code %d", errChildExited, code)
+		case <-sigs:
+			return errShutdown
+		case <-ctx.Done():
+			return fmt.Errorf("startup check did not pass within %s: %v", timeout, lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// stopChild terminates a supervised child and waits for it to exit, killing
+// it if it is still running after the grace period.
+func stopChild(cmd *exec.Cmd, grace time.Duration, exited <-chan int) {
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		_ = cmd.Process.Kill()
+	}
+	var kill <-chan time.Time
+	if grace > 0 {
+		kill = time.After(grace)
+	}
+	select {
+	case <-exited:
+		return
+	case <-kill:
+		log.Printf("Warning: Command did not exit within %s, killing it", grace)
+		_ = cmd.Process.Kill()
+	}
+	<-exited
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// templateFile is a file found in a template directory. Static files do not
+// have a template extension and are copied verbatim.
+type templateFile struct {
+	path   string
+	static bool
+}
+
+// copyStatic reports whether ENVWARP_COPY_STATIC is enabled, so files
+// without a template extension are copied into the config directory too.
+func copyStatic() bool {
+	return envEnabled("ENVWARP_COPY_STATIC")
+}
+
+// isRegularFile reports whether the directory entry at path is a regular
+// file or a symlink to one, as in Kubernetes ConfigMap volumes.
+func isRegularFile(path string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink != 0 {
+		fi, err := os.Stat(path)
+		return err == nil && fi.Mode().IsRegular()
+	}
+	return d.Type().IsRegular()
+}
+
+// loadStaticFile reads a static file into a job that copies it through
+// unchanged. Large files are streamed like large templates. Transient
+// filesystem errors are retried.
+func loadStaticFile(source string) (renderJob, *templateError) {
+	var info fs.FileInfo
+	err := retryFS(source, func() (err error) {
+		info, err = os.Stat(source)
+		return err
+	})
+	if err != nil {
+		return renderJob{}, &templateError{file: source, err: fmt.Errorf("cannot stat file: %w", err)}
+	}
+	if size, err := templateStreamSize(); err == nil && size > 0 && info.Size() >= size {
+		return renderJob{source: source, info: info, binary: true, stream: true}, nil
+	}
+	var raw []byte
+	err = retryFS(source, func() (err error) {
+		raw, err = os.ReadFile(source)
+		return err
+	})
+	if err != nil {
+		return renderJob{}, &templateError{file: source, err: fmt.Errorf("failed to read: %w", err)}
+	}
+	return renderJob{source: source, body: raw, info: info, binary: true}, nil
+}
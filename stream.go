@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+const (
+	// defaultTemplateStreamSize is the template size from which envsubst
+	// templates are streamed instead of rendered in memory.
+	defaultTemplateStreamSize = 32 << 20
+	// streamHeadSize bounds the part of a streamed template read up front
+	// for its front matter.
+	streamHeadSize = 64 << 10
+)
+
+// templateStreamSize returns the size from which templates are streamed,
+// from ENVWARP_TEMPLATE_STREAM_SIZE. Zero disables streaming.
+func templateStreamSize() (int64, error) {
+	value := os.Getenv("ENVWARP_TEMPLATE_STREAM_SIZE")
+	if value == "" {
+		return defaultTemplateStreamSize, nil
+	}
+	return parseSize(value)
+}
+
+// loadStreamTemplate reads only the head of a large template, for its front
+// matter, and leaves the body on disk to be streamed.
+func loadStreamTemplate(source string, info fs.FileInfo, binaryMode string) (renderJob, frontMatter, *templateError) {
+	var head []byte
+	err := retryFS(source, func() error {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		head = make([]byte, streamHeadSize)
+		n, err := io.ReadFull(f, head)
+		head = head[:n]
+		if err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return renderJob{}, nil, &templateError{file: source, err: fmt.Errorf("failed to read: %w", err)}
+	}
+
+	if bytes.IndexByte(head, 0) != -1 {
+		if binaryMode != "copy" {
+			return renderJob{}, nil, &templateError{file: source, err: errors.New("template appears to be binary, set ENVWARP_BINARY=copy to copy it unchanged")}
+		}
+		return renderJob{source: source, info: info, binary: true, stream: true}, frontMatter{}, nil
+	}
+	fm, body := parseFrontMatter(head)
+	header := head[:len(head)-len(body)]
+	return renderJob{source: source, info: info, offset: bytes.Count(header, []byte("\n")), stream: true, start: int64(len(header))}, fm, nil
+}
+
+// renderStream renders a streamed job into a file in the scratch directory,
+// charging its output to budget, and returns its path.
+func renderStream(job renderJob, budget *outputBudget) (string, error) {
+	root, err := scratchDir()
+	if err != nil {
+		return "", err
+	}
+	out, err := os.CreateTemp(root, "stream-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging file: %w", err)
+	}
+	err = streamTemplate(job, &budgetWriter{w: out, budget: budget})
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to write staging file: %w", cerr)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// streamTemplate substitutes the body of a large envsubst template line by
+// line, so memory use follows the longest line rather than the size of the
+// template. An expression spanning several lines is therefore not expanded.
+// Binary templates are copied through.
+func streamTemplate(job renderJob, out io.Writer) error {
+	var f *os.File
+	err := retryFS(job.source, func() (err error) {
+		f, err = os.Open(job.source)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(job.start, io.SeekStart); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	if job.binary {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	strict := strictMode()
+	trimFinal := envEnabled("ENVWARP_FINAL_NEWLINE")
+	cond := &conditionals{file: job.source}
+	var unset templateErrors
+	seen := map[string]bool{}
+	// With ENVWARP_FINAL_NEWLINE, trailing line breaks are held back until
+	// more content follows.
+	var pending []byte
+	written := false
+
+	reader := bufio.NewReaderSize(f, streamHeadSize)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			keep := true
+			if job.directives {
+				var cerr error
+				if keep, cerr = cond.line(lineNo, line); cerr != nil {
+					return cerr
+				}
+			}
+			content := line
+			if keep && bytes.ContainsAny(line, "$#") {
+				var rerr error
+				content, rerr = renderLine(job, line, strict)
+				part := renderJob{source: job.source, body: line, offset: job.offset + lineNo - 1}
+				if uerr, ok := rerr.(*unsetVarsError); ok {
+					// Keep going to report every unset variable at once,
+					// each at its first reference
+					for _, name := range uerr.names {
+						if !seen[name] {
+							seen[name] = true
+							unset = append(unset, renderFailures(part, &unsetVarsError{names: []string{name}})...)
+						}
+					}
+					content = nil
+				} else if rerr != nil {
+					var terr *templateError
+					if errors.As(rerr, &terr) {
+						return rerr
+					}
+					if errs := envsubstFailures(part); len(errs) > 0 {
+						return errs
+					}
+					return templateErrors{{file: job.source, line: job.offset + lineNo, err: rerr}}
+				}
+			}
+			if keep {
+				content = trimTrailingWhitespace(content)
+				if trimFinal {
+					body := bytes.TrimRight(content, "\r\n")
+					if len(body) == 0 {
+						pending = append(pending, content...)
+						content = nil
+					} else {
+						w.Write(pending)
+						pending = append(pending[:0], content[len(body):]...)
+						content = body
+					}
+				}
+				written = written || len(content) > 0
+				if _, err := w.Write(content); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := cond.end(); err != nil {
+		return err
+	}
+	if len(unset) > 0 {
+		return unset
+	}
+	if trimFinal && written {
+		w.Write(finalNewline(pending))
+	}
+	return w.Flush()
+}
+
+// renderLine substitutes one line of a streamed job after resolving an
+// include directive on it, if directives are enabled.
+func renderLine(job renderJob, line []byte, strict bool) ([]byte, error) {
+	body := line
+	if job.directives && bytes.Contains(line, []byte("#include")) {
+		var err error
+		if body, err = expandIncludes(line, 0); err != nil {
+			return nil, err
+		}
+	}
+	text := string(body)
+	if passthroughMode() {
+		text = keepUnsetReferences(text)
+	}
+	var content string
+	var err error
+	escape := valueEscapers[job.escape]
+	if strict {
+		content, err = expandEnvStrict(job.source, text, escape)
+	} else {
+		content, err = expandEscaped(text, escape)
+	}
+	return []byte(content), err
+}
+
+// removeStaged removes the staging files of streamed jobs.
+func removeStaged(jobs []renderJob) {
+	for _, job := range jobs {
+		if job.staged != "" {
+			os.Remove(job.staged)
+		}
+	}
+}
+
+// filesEqual reports whether the files at a and b have the same content,
+// without loading either into memory.
+func filesEqual(a, b string) bool {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+	if sa, err := fa.Stat(); err != nil {
+		return false
+	} else if sb, err := fb.Stat(); err != nil || sa.Size() != sb.Size() {
+		return false
+	}
+
+	// The sizes match, so both files end in the same read
+	bufA, bufB := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return true
+		}
+		if errA != nil || errB != nil {
+			return false
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/a8m/envsubst/parse"
+)
+
+var (
+	unsetVarLine   = regexp.MustCompile(`^variable \$\{(.+)\} not set$`)
+	missingKeyExpr = regexp.MustCompile(`map has no entry for key "([^"]+)"`)
+)
+
+// unsetVarsError lists the unset variables referenced by a template.
+type unsetVarsError struct {
+	names []string
+}
+
+func (e *unsetVarsError) Error() string {
+	return "unset variables: " + strings.Join(e.names, ", ")
+}
+
+// strictMode reports whether ENVWARP_STRICT (or --strict) is enabled.
+func strictMode() bool {
+	return envEnabled("ENVWARP_STRICT")
+}
+
+// expandEnvStrict is expandEnv, but fails with an *unsetVarsError listing
+// every unset variable that is referenced without a default.
+func expandEnvStrict(name, text string, escape func(string) string) (string, error) {
+	text, err := checkRequired(text, escape)
+	if err != nil {
+		return "", err
+	}
+	p := parse.New(name, escapedEnviron(escape), parse.NoUnset)
+	p.Mode = parse.AllErrors
+	out, err := p.Parse(text)
+	if err == nil {
+		return out, nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		m := unsetVarLine.FindStringSubmatch(line)
+		if m == nil {
+			// Anything other than unset variables is a real error.
+			return "", err
+		}
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return "", &unsetVarsError{names: names}
+}
+
+// missingKey extracts the variable name from a Go template missingkey=error failure.
+func missingKey(err error) (string, bool) {
+	m := missingKeyExpr.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// setStrictFlag applies a --strict flag, which enables ENVWARP_STRICT.
+func setStrictFlag(strict bool) {
+	if strict {
+		os.Setenv("ENVWARP_STRICT", "true")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultStopGracePeriod = 10 * time.Second
+
+// stopGracePeriod returns how long a supervised command may take to exit
+// after a termination signal before it is killed, from
+// ENVWARP_STOP_GRACE_PERIOD (default 10s). Zero waits indefinitely.
+func stopGracePeriod() (time.Duration, error) {
+	value := os.Getenv("ENVWARP_STOP_GRACE_PERIOD")
+	if value == "" {
+		return defaultStopGracePeriod, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid ENVWARP_STOP_GRACE_PERIOD %q, must be a non-negative duration", value)
+	}
+	return d, nil
+}
+
+// startChild starts argv as a child process sharing envwarp's stdio.
+func startChild(argv []string, customEnv []string) (*exec.Cmd, error) {
+	cmdPath, argv, err := lookupCommand(argv)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Starting command: %s", strings.Join(argv, " "))
+	cmd := exec.Command(cmdPath, argv[1:]...)
+	cmd.Env = childEnvironment(customEnv)
+	cmd.SysProcAttr = childSysProcAttr()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	return cmd, nil
+}
+
+// waitChild forwards signals to the child until it exits and returns its exit
+// code. Once a termination signal has been forwarded, the child is killed if
+// it is still running after the grace period.
+func waitChild(cmd *exec.Cmd, grace time.Duration) int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+
+	done := make(chan struct{})
+	go func() {
+		var kill <-chan time.Time
+		for {
+			select {
+			case sig := <-sigs:
+				_ = cmd.Process.Signal(sig)
+				if kill == nil && grace > 0 && (sig == syscall.SIGTERM || sig == syscall.SIGINT) {
+					kill = time.After(grace)
+				}
+			case <-kill:
+				log.Printf("Warning: Command did not exit within %s, killing it", grace)
+				_ = cmd.Process.Kill()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	return exitCode(cmd, err)
+}
+
+// exitCode converts the result of cmd.Wait into a shell-style exit code.
+func exitCode(cmd *exec.Cmd, err error) int {
+	if cmd.ProcessState == nil {
+		log.Printf("Error: Command failed: %v", err)
+		return 1
+	}
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		log.Printf("Command terminated by signal: %v", ws.Signal())
+		return 128 + int(ws.Signal())
+	}
+	code := cmd.ProcessState.ExitCode()
+	log.Printf("Command exited with code %d", code)
+	return code
+}
+
+// waitForSignal blocks until a termination signal is received.
+func waitForSignal() int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	log.Printf("Received %v, exiting", sig)
+	return 0
+}
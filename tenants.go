@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// renderAll renders the template tree into confDir, or once per tenant into
+// per-tenant subdirectories if a tenant list is configured.
+func renderAll(templatePath, confDir string) ([]string, error) {
+	tenants, err := loadTenants()
+	if err != nil {
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return processTemplates(templatePath, confDir)
+	}
+
+	var outputs []string
+	for _, tenant := range tenants {
+		log.Printf("Rendering templates for tenant: %s", tenant)
+		tenantDir := filepath.Join(confDir, tenant)
+		if confDir == stdoutDir {
+			tenantDir = stdoutDir
+		}
+		tenantOutputs, err := renderTenant(tenant, templatePath, tenantDir)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		outputs = append(outputs, tenantOutputs...)
+	}
+	return outputs, nil
+}
+
+// renderTenant renders the template tree with ENVWARP_TENANT set and the
+// tenant's env file loaded, restoring the environment afterwards.
+func renderTenant(tenant, templatePath, confDir string) ([]string, error) {
+	saved := os.Environ()
+	defer restoreEnvironment(saved)
+
+	if err := os.Setenv("ENVWARP_TENANT", tenant); err != nil {
+		return nil, err
+	}
+	if envDir := os.Getenv("ENVWARP_TENANT_ENV_DIR"); envDir != "" {
+		envFile := filepath.Join(envDir, tenant+".env")
+		if _, err := os.Stat(envFile); err == nil {
+			if err := loadEnvFiles(stringSlice{envFile}); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot stat tenant env file %s: %w", envFile, err)
+		}
+	}
+	return processTemplates(templatePath, confDir)
+}
+
+// restoreEnvironment replaces the process environment with a saved snapshot.
+func restoreEnvironment(saved []string) {
+	os.Clearenv()
+	for _, env := range saved {
+		key, value, _ := strings.Cut(env, "=")
+		_ = os.Setenv(key, value)
+	}
+}
+
+// loadTenants returns the tenant list from ENVWARP_TENANTS (comma-separated)
+// or ENVWARP_TENANTS_FILE (one tenant per line, # for comments).
+func loadTenants() ([]string, error) {
+	var names []string
+	if value := os.Getenv("ENVWARP_TENANTS"); value != "" {
+		names = strings.Split(value, ",")
+	} else if path := os.Getenv("ENVWARP_TENANTS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tenants file %s: %w", path, err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			names = append(names, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read tenants file %s: %w", path, err)
+		}
+	}
+
+	var tenants []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid tenant name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate tenant %q", name)
+		}
+		seen[name] = true
+		tenants = append(tenants, name)
+	}
+	return tenants, nil
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// tmpfsMagic is the filesystem type reported by statfs for tmpfs mounts.
+const tmpfsMagic = 0x01021994
+
+// tmpfsDetection reports whether isTmpfs can detect tmpfs mounts.
+const tmpfsDetection = true
+
+// isTmpfs reports whether path resides on a tmpfs mount.
+func isTmpfs(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == tmpfsMagic
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// tmpfsDetection reports whether isTmpfs can detect tmpfs mounts, which is
+// only supported on Linux.
+const tmpfsDetection = false
+
+// isTmpfs reports whether path resides on a tmpfs mount.
+func isTmpfs(path string) bool {
+	return false
+}
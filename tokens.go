@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultOIDCTokenURL is the GCE metadata server's identity token
+	// endpoint, which also serves GKE workload identity.
+	defaultOIDCTokenURL    = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+	defaultOIDCTokenHeader = "Metadata-Flavor: Google"
+	templateHTTPTimeout    = 10 * time.Second
+	// maxTemplateHTTPBody bounds a response fetched by a template helper.
+	maxTemplateHTTPBody = 1 << 20
+)
+
+var errTemplateHTTPDisabled = errors.New("fetching URLs from templates is disabled, set ENVWARP_TEMPLATE_HTTP=1 to enable it")
+
+// fetchURL is the httpGet template helper. It returns the body of an http://
+// URL, with surrounding whitespace trimmed, sending each extra argument as a
+// "Name: value" header. It only works if ENVWARP_TEMPLATE_HTTP is enabled.
+func fetchURL(address string, headers ...string) (string, error) {
+	if !envEnabled("ENVWARP_TEMPLATE_HTTP") {
+		return "", errTemplateHTTPDisabled
+	}
+	body, err := httpGet(address, headers, maxTemplateHTTPBody, templateHTTPTimeout)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// oidcToken returns an OIDC identity token for audience from the metadata
+// endpoint at ENVWARP_OIDC_TOKEN_URL, sending ENVWARP_OIDC_TOKEN_HEADER. Both
+// default to the GCE metadata server.
+func oidcToken(audience string) (string, error) {
+	address := os.Getenv("ENVWARP_OIDC_TOKEN_URL")
+	if address == "" {
+		address = defaultOIDCTokenURL
+	}
+	header := os.Getenv("ENVWARP_OIDC_TOKEN_HEADER")
+	if header == "" {
+		header = defaultOIDCTokenHeader
+	}
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+	return fetchURL(address+separator+"audience="+url.QueryEscape(audience), header)
+}
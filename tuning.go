@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sysctlRoot = "/proc/sys"
+	thpEnabled = "/sys/kernel/mm/transparent_hugepage/enabled"
+)
+
+// applyTuning applies the sysctls in ENVWARP_SYSCTLS and the transparent
+// hugepage mode in ENVWARP_THP. Containers are often not permitted to change
+// these, so write failures are logged as warnings instead of aborting.
+func applyTuning() error {
+	if sysctls := os.Getenv("ENVWARP_SYSCTLS"); sysctls != "" {
+		for _, entry := range strings.Split(sysctls, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("invalid sysctl %q, expected key=value", entry)
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			path := filepath.Join(sysctlRoot, strings.ReplaceAll(key, ".", "/"))
+			writeTunable(path, key, value)
+		}
+	}
+
+	if thp := os.Getenv("ENVWARP_THP"); thp != "" {
+		switch thp {
+		case "always", "madvise", "never":
+			writeTunable(thpEnabled, "transparent_hugepage", thp)
+		default:
+			return fmt.Errorf("invalid ENVWARP_THP value %q, must be one of always, madvise, never", thp)
+		}
+	}
+	return nil
+}
+
+// writeTunable writes value to a kernel tunable, warning if it is not permitted.
+func writeTunable(path, name, value string) {
+	if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+		log.Printf("Warning: Failed to set %s=%s: %v", name, value, err)
+		return
+	}
+	log.Printf("Set %s=%s", name, value)
+}
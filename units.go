@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sizeBytes parses a byte size such as 512Mi or 1G and returns it in bytes.
+func sizeBytes(value string) (int64, error) {
+	return parseSize(value)
+}
+
+// durationSeconds parses a duration such as 2h30m and returns it in whole
+// seconds, failing if it has a fractional part that would be lost.
+func durationSeconds(value string) (int64, error) {
+	return durationIn(value, time.Second, "seconds")
+}
+
+// durationMillis parses a duration such as 1.5s and returns it in whole
+// milliseconds.
+func durationMillis(value string) (int64, error) {
+	return durationIn(value, time.Millisecond, "milliseconds")
+}
+
+// durationIn parses a duration and converts it to a whole number of units.
+func durationIn(value string, unit time.Duration, name string) (int64, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	if d%unit != 0 {
+		return 0, fmt.Errorf("duration %q is not a whole number of %s", value, name)
+	}
+	return int64(d / unit), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestDurationHelpers(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(string) (int64, error)
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "durationSeconds", fn: durationSeconds, value: "2h30m", want: 9000},
+		{name: "durationSeconds", fn: durationSeconds, value: "0s", want: 0},
+		{name: "durationSeconds", fn: durationSeconds, value: "-1m", want: -60},
+		{name: "durationSeconds", fn: durationSeconds, value: "1.5s", wantErr: true},
+		{name: "durationSeconds", fn: durationSeconds, value: "10", wantErr: true},
+		{name: "durationSeconds", fn: durationSeconds, value: "", wantErr: true},
+		{name: "durationMillis", fn: durationMillis, value: "1.5s", want: 1500},
+		{name: "durationMillis", fn: durationMillis, value: "250ms", want: 250},
+		{name: "durationMillis", fn: durationMillis, value: "1m", want: 60000},
+		{name: "durationMillis", fn: durationMillis, value: "1500us", wantErr: true},
+		{name: "durationMillis", fn: durationMillis, value: "soon", wantErr: true},
+		{name: "sizeBytes", fn: sizeBytes, value: "512Mi", want: 512 << 20},
+		{name: "sizeBytes", fn: sizeBytes, value: "1G", want: 1 << 30},
+		{name: "sizeBytes", fn: sizeBytes, value: "big", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s(%q) = %d, want error", tt.name, tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s(%q) failed: %v", tt.name, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s(%q) = %d, want %d", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 60 * time.Second
+	waitPollInterval   = 500 * time.Millisecond
+)
+
+// waitForPaths blocks until all paths in ENVWARP_WAITFOR_PATHS exist and are
+// writable, or fails once ENVWARP_WAITFOR_TIMEOUT has elapsed.
+func waitForPaths() error {
+	spec := os.Getenv("ENVWARP_WAITFOR_PATHS")
+	if spec == "" {
+		return nil
+	}
+
+	timeout := defaultWaitTimeout
+	if value := os.Getenv("ENVWARP_WAITFOR_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid ENVWARP_WAITFOR_TIMEOUT %q: %w", value, err)
+		}
+		timeout = d
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, path := range strings.Split(spec, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		log.Printf("Waiting for path: %s", path)
+		for {
+			err := checkWritable(path)
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out after %s waiting for %s: %w", timeout, path, err)
+			}
+			time.Sleep(waitPollInterval)
+		}
+		log.Printf("Path is ready: %s", path)
+	}
+	return nil
+}
+
+// checkWritable verifies that path exists and can be written to.
+// Directories are probed by creating and removing a temporary file.
+func checkWritable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	f, err := os.CreateTemp(path, ".envwarp-probe-")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultReloadSignal = "SIGHUP"
+
+// watchSettings returns how often the config is re-rendered in watch mode,
+// from ENVWARP_WATCH_INTERVAL, and the secrets to refresh. Watch mode is on
+// if either is set. It re-renders in place, so it cannot be combined with
+// generations or stdout output, and it runs its own supervision loop
+// instead of the scheduler or the startup gate.
+func watchSettings(confDir string) (time.Duration, []secretRefresh, error) {
+	var interval time.Duration
+	if value := os.Getenv("ENVWARP_WATCH_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, nil, fmt.Errorf("invalid ENVWARP_WATCH_INTERVAL %q, must be a positive duration", value)
+		}
+		interval = d
+	}
+	refreshes, err := secretRefreshes()
+	if err != nil {
+		return 0, nil, err
+	}
+	if interval == 0 && len(refreshes) == 0 {
+		return 0, nil, nil
+	}
+	switch {
+	case confDir == stdoutDir:
+		return 0, nil, errors.New("watch mode cannot be used when printing to stdout")
+	case generationsEnabled():
+		return 0, nil, errors.New("watch mode cannot be combined with ENVWARP_GENERATIONS")
+	case os.Getenv("ENVWARP_CRONTAB") != "":
+		return 0, nil, errors.New("watch mode cannot be combined with ENVWARP_CRONTAB")
+	case os.Getenv("ENVWARP_STARTUP_CHECK") != "":
+		return 0, nil, errors.New("watch mode cannot be combined with ENVWARP_STARTUP_CHECK")
+	}
+	return interval, refreshes, nil
+}
+
+// runWatch starts argv supervised and calls render every interval, unless
+// it is zero, and whenever a refreshed secret changed. When the rendered
+// files differ from outputs, the previous render, or a secret written to
+// ENVWARP_SECRETS_OUTDIR changed, the command is told to reload. A failed
+// render is logged and leaves the running config in place. Without a
+// command, envwarp re-renders until it receives a termination signal. It
+// exits with the command's exit code after running ENVWARP_POST_EXIT.
+func runWatch(interval time.Duration, refreshes []secretRefresh, argv []string, customEnv []string, outputs []string, render func() ([]string, error)) {
+	grace, err := stopGracePeriod()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var reload func() error
+	var exited <-chan int
+	sigs := make(chan os.Signal, 1)
+	if len(argv) == 0 {
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	} else {
+		emitEvent(execEvent(argv))
+		child, err := startChild(argv, customEnv)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if reload, err = childReloader(child, customEnv); err != nil {
+			_ = child.Process.Kill()
+			log.Fatalf("Error: %v", err)
+		}
+		exited = superviseChild(child, grace)
+	}
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		log.Printf("Watching templates, re-rendering every %s", interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	due := make(chan string)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, r := range refreshes {
+		log.Printf("Refreshing secret %s every %s", r.name, r.interval)
+		go func() {
+			ticker := time.NewTicker(r.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					select {
+					case due <- r.name:
+					case <-stop:
+						return
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	digest := outputDigest(outputs)
+	update := func(secretChanged bool) {
+		outputs, err := render()
+		if err != nil {
+			log.Printf("Warning: Failed to re-render templates, not reloading: %v", err)
+			return
+		}
+		next := outputDigest(outputs)
+		if next == digest && !secretChanged {
+			return
+		}
+		digest = next
+		log.Println("Rendered config changed.")
+		if reload == nil {
+			return
+		}
+		if err := reload(); err != nil {
+			log.Printf("Warning: Failed to reload command: %v", err)
+		}
+	}
+
+	var code int
+	for running := true; running; {
+		select {
+		case code = <-exited:
+			running = false
+		case sig := <-sigs:
+			log.Printf("Received %v, exiting", sig)
+			running = false
+		case <-tick:
+			update(false)
+		case name := <-due:
+			changed, err := refreshSecret(name)
+			if err != nil {
+				log.Printf("Warning: Failed to refresh secret %s: %v", name, err)
+			}
+			if changed {
+				update(os.Getenv("ENVWARP_SECRETS_OUTDIR") != "")
+			}
+		}
+	}
+
+	if err := runPostExitHook(customEnv, code); err != nil {
+		log.Printf("Error: %v", err)
+	}
+	os.Exit(code)
+}
+
+// childReloader returns a function that tells child to reload its config,
+// by running ENVWARP_RELOAD_COMMAND if set and otherwise by sending it
+// ENVWARP_RELOAD_SIGNAL (default SIGHUP).
+func childReloader(child *exec.Cmd, customEnv []string) (func() error, error) {
+	if command := os.Getenv("ENVWARP_RELOAD_COMMAND"); command != "" {
+		parts, err := splitCommand(command)
+		if err != nil || len(parts) == 0 {
+			return nil, fmt.Errorf("invalid ENVWARP_RELOAD_COMMAND %q", command)
+		}
+		return func() error {
+			log.Printf("Reloading command: %s", command)
+			cmd := exec.Command(parts[0], parts[1:]...)
+			cmd.Env = childEnvironment(customEnv)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		}, nil
+	}
+
+	name := os.Getenv("ENVWARP_RELOAD_SIGNAL")
+	if name == "" {
+		name = defaultReloadSignal
+	}
+	sig, ok := reloadSignals[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("invalid ENVWARP_RELOAD_SIGNAL %q, must be one of %s", name, reloadSignalNames())
+	}
+	return func() error {
+		log.Printf("Sending %s to command", strings.ToUpper(name))
+		return child.Process.Signal(sig)
+	}, nil
+}
+
+// outputDigest returns a digest of the names and contents of outputs and
+// the ENVWARP_PATCH_FILE target, to tell whether a render changed anything.
+// Unreadable files are left out.
+func outputDigest(outputs []string) string {
+	h := sha256.New()
+	if patched := os.Getenv("ENVWARP_PATCH_FILE"); patched != "" {
+		outputs = append(outputs[:len(outputs):len(outputs)], patched)
+	}
+	for _, output := range outputs {
+		fmt.Fprintf(h, "%s\x00", output)
+		f, err := os.Open(output)
+		if err != nil {
+			continue
+		}
+		_, _ = io.Copy(h, f)
+		f.Close()
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// rerender renders the template directory and the -t pairs again for watch
+// mode and validates the result like the initial render, restoring the
+// previous config if validation fails and ENVWARP_ROLLBACK is enabled.
+// Pipelines are only rendered at startup.
+func rerender(templatePath, confDir string, pairs []templatePair, customEnv []string) ([]string, error) {
+	defer cleanupScratch()
+	var snap *configSnapshot
+	var err error
+	if templatePath != "" && os.Getenv("ENVWARP_VALIDATE") != "" && envEnabled("ENVWARP_ROLLBACK") {
+		if snap, err = takeSnapshot(confDir, os.Getenv("ENVWARP_PATCH_FILE")); err != nil {
+			return nil, fmt.Errorf("failed to save previous config: %w", err)
+		}
+	}
+
+	var outputs []string
+	if templatePath != "" {
+		if outputs, err = renderConfig(templatePath, confDir); err != nil {
+			return nil, err
+		}
+	}
+	if len(pairs) > 0 {
+		pairOutputs, err := processPairs(pairs)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, pairOutputs...)
+	}
+	if err := processPatch(); err != nil {
+		return nil, fmt.Errorf("failed to patch config file: %w", err)
+	}
+	if err := validateConfig(snap, customEnv); err != nil {
+		return nil, err
+	}
+	if pruneEnabled() && templatePath != "" {
+		if err := pruneStale(confDir, outputs); err != nil {
+			log.Printf("Warning: Failed to prune stale files: %v", err)
+		}
+	}
+	if err := writeManifest(outputs); err != nil {
+		log.Printf("Warning: Failed to write render manifest: %v", err)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// trailingWhitespace matches spaces and tabs at the end of a line.
+var trailingWhitespace = regexp.MustCompile(`(?m)[ \t]+(\r?)$`)
+
+// normalizeWhitespace cleans up rendered content for picky consumers such as
+// HAProxy maps: ENVWARP_TRIM_TRAILING_WHITESPACE strips trailing spaces and
+// tabs from every line, and ENVWARP_FINAL_NEWLINE makes non-empty content end
+// with exactly one newline.
+func normalizeWhitespace(content []byte) []byte {
+	content = trimTrailingWhitespace(content)
+	if envEnabled("ENVWARP_FINAL_NEWLINE") {
+		newline := finalNewline(content)
+		content = bytes.TrimRight(content, "\r\n")
+		if len(content) > 0 {
+			content = append(content, newline...)
+		}
+	}
+	return content
+}
+
+// trimTrailingWhitespace strips trailing spaces and tabs from every line if
+// ENVWARP_TRIM_TRAILING_WHITESPACE is enabled.
+func trimTrailingWhitespace(content []byte) []byte {
+	if !envEnabled("ENVWARP_TRIM_TRAILING_WHITESPACE") {
+		return content
+	}
+	return trailingWhitespace.ReplaceAll(content, []byte("$1"))
+}
+
+// finalNewline returns the line ending content ends with: \r\n if its
+// last line break is one, \n otherwise.
+func finalNewline(content []byte) []byte {
+	if bytes.HasSuffix(bytes.TrimRight(content, "\n"), []byte("\r")) {
+		return []byte("\r\n")
+	}
+	return []byte("\n")
+}
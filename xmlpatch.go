@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// xmlAssignment sets the text of the elements matched by path, or the
+// attribute attr on them if attr is not empty.
+type xmlAssignment struct {
+	path  string
+	attr  string
+	value string
+}
+
+// patchXML applies the assignments from ENVWARP_PATCH_DOCUMENT to XML content.
+// Each non-empty line of the document has the form `XPATH = VALUE`, where a
+// trailing `/@name` in the path addresses an attribute instead of the text.
+func patchXML(content []byte) ([]byte, error) {
+	patchPath := os.Getenv("ENVWARP_PATCH_DOCUMENT")
+	if patchPath == "" {
+		return nil, fmt.Errorf("ENVWARP_PATCH_DOCUMENT must be set for xml patches")
+	}
+	raw, err := os.ReadFile(patchPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch document %s: %w", patchPath, err)
+	}
+	expanded, err := expandEnv(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to substitute patch document %s: %w", patchPath, err)
+	}
+	patchContent := []byte(expanded)
+	assignments, err := parseXMLAssignments(patchContent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch document %s: %w", patchPath, err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	for _, a := range assignments {
+		path, err := etree.CompilePath(a.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", a.path, err)
+		}
+		elements := doc.FindElementsPath(path)
+		if len(elements) == 0 {
+			return nil, fmt.Errorf("path %q matched no elements", a.path)
+		}
+		for _, e := range elements {
+			if a.attr != "" {
+				e.CreateAttr(a.attr, a.value)
+			} else {
+				e.SetText(a.value)
+			}
+		}
+		log.Printf("Set %s%s on %d element(s)", a.path, attrSuffix(a.attr), len(elements))
+	}
+
+	return doc.WriteToBytes()
+}
+
+// parseXMLAssignments parses `XPATH = VALUE` lines, ignoring blanks and # comments.
+func parseXMLAssignments(content []byte) ([]xmlAssignment, error) {
+	var assignments []xmlAssignment
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := assignmentIndex(line)
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected XPATH = VALUE", lineNo)
+		}
+		a := xmlAssignment{
+			path:  strings.TrimSpace(line[:idx]),
+			value: strings.TrimSpace(line[idx+1:]),
+		}
+		if slash := strings.LastIndex(a.path, "/@"); slash != -1 {
+			a.path, a.attr = a.path[:slash], a.path[slash+2:]
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, scanner.Err()
+}
+
+// assignmentIndex returns the index of the first '=' outside of predicates and quotes.
+func assignmentIndex(line string) int {
+	depth := 0
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == '=' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+func attrSuffix(attr string) string {
+	if attr == "" {
+		return ""
+	}
+	return "/@" + attr
+}